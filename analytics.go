@@ -0,0 +1,36 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// analyticsProviders holds the script tag for each supported analytics
+// service, filled in with the configured site ID and the response's CSP
+// nonce.
+var analyticsProviders = map[string]*template.Template{
+	"plausible": template.Must(template.New("plausible").Parse(
+		`<script defer data-domain="{{.SiteID}}" src="https://plausible.io/js/script.js"{{with .Nonce}} nonce="{{.}}"{{end}}></script>`)),
+	"goatcounter": template.Must(template.New("goatcounter").Parse(
+		`<script async data-goatcounter="https://{{.SiteID}}.goatcounter.com/count" src="https://gc.zgo.at/count.js"{{with .Nonce}} nonce="{{.}}"{{end}}></script>`)),
+}
+
+// analyticsSnippet returns the analytics script tag for req, exposed to
+// templates as .Analytics. It is empty unless a provider is configured and
+// conf().Env is "production", so development traffic is never counted.
+func analyticsSnippet(req *http.Request) template.HTML {
+	c := conf()
+	t, ok := analyticsProviders[c.AnalyticsProvider]
+	if !ok || c.Env != "production" {
+		return ""
+	}
+	var b strings.Builder
+	err := t.Execute(&b, map[string]string{"SiteID": c.AnalyticsSiteID, "Nonce": cspNonce(req)})
+	if err != nil {
+		slog.Warn("analytics snippet", "provider", c.AnalyticsProvider, "err", err)
+		return ""
+	}
+	return template.HTML(b.String())
+}
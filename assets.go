@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// assetHashes is the asset manifest: content hashes of static files, keyed
+// by file path. precomputeAssetHashes fills it at startup; files it missed
+// are hashed on first use. Entries remember the file's size and modification
+// time so a file edited in place is hashed again.
+var assetHashes sync.Map
+
+// assetHash is one assetHashes entry.
+type assetHash struct {
+	sum     string // hex SHA-256 of the content
+	size    int64
+	modTime time.Time
+}
+
+// resetAssetHashes forgets all cached asset hashes.
+func resetAssetHashes() {
+	assetHashes.Range(func(key, _ any) bool {
+		assetHashes.Delete(key)
+		return true
+	})
+}
+
+// fileHash returns the content hash of file from the manifest, hashing and
+// recording it if it is missing or stale. ok is false when file can't be
+// read.
+func fileHash(file string) (sum string, ok bool) {
+	info, err := os.Stat(file)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	if v, ok := assetHashes.Load(file); ok {
+		if h := v.(assetHash); h.size == info.Size() && h.modTime.Equal(info.ModTime()) {
+			return h.sum, true
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", false
+	}
+	h := assetHash{sum: hex.EncodeToString(hash.Sum(nil)), size: info.Size(), modTime: info.ModTime()}
+	assetHashes.Store(file, h)
+	return h.sum, true
+}
+
+// precomputeAssetHashes hashes every file under dirs into the manifest, so
+// the first requests for assets already get content ETags and versions.
+func precomputeAssetHashes(dirs []string) {
+	start := time.Now()
+	n := 0
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if _, ok := fileHash(p); ok {
+					n++
+				}
+			}
+			return nil
+		})
+	}
+	slog.Debug("asset manifest built", "files", n, "duration", time.Since(start))
+}
+
+// assetURL appends a ?v= cache-busting version to a /public/ asset path. The
+// version is a short content hash from the asset manifest; when the file
+// can't be read the build version is used instead.
+func assetURL(publicDir, asset string) string {
+	rel, ok := strings.CutPrefix(asset, "/public/")
+	if !ok {
+		return asset
+	}
+	file := filepath.Join(publicDir, filepath.FromSlash(path.Clean("/"+rel)))
+	if sum, ok := fileHash(file); ok {
+		return asset + "?v=" + sum[:10]
+	}
+	return asset + "?v=" + buildVersion()
+}
+
+// assetETag returns the ETag for file: strong and content-based when it
+// can be hashed, otherwise weak and based on its size and modification
+// time, as for a file that vanished between Stat and hashing.
+func assetETag(file string, info os.FileInfo) string {
+	if sum, ok := fileHash(file); ok {
+		return `"` + sum[:32] + `"`
+	}
+	return fmt.Sprintf(`W/"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// buildVersion returns the VCS revision the binary was built from, or "dev".
+var buildVersion = sync.OnceValue(func() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 10 {
+				return s.Value[:10]
+			}
+		}
+	}
+	return "dev"
+})
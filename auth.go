@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Auth tiers for auth_rules.
+const (
+	authNone   = "none"   // public
+	authShared = "shared" // basic_user / basic_pass
+	authAdmin  = "admin"  // admin_user / admin_pass; refused while either is unset
+)
+
+// userKey is the request context key for the authenticated user name.
+type userKey struct{}
+
+// authUser returns the user name authorize verified for req, or "" when the
+// path is public or was admitted by API key. Credentials sent to a public
+// path are never checked and so never reported.
+func authUser(req *http.Request) string {
+	user, _ := req.Context().Value(userKey{}).(string)
+	return user
+}
+
+// authTier returns the tier of the longest auth_rules prefix matching path,
+// or authNone when no rule matches.
+func authTier(c *Config, path string) string {
+	tier, longest := authNone, -1
+	for prefix, t := range c.AuthRules {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			tier, longest = t, len(prefix)
+		}
+	}
+	return tier
+}
+
+// authorize enforces HTTP Basic authentication according to conf().AuthRules.
+// Rules and credentials are read per request so a SIGHUP reload takes effect
+// at once.
+func authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c := conf()
+		var wantUser, wantPass, realm string
+		switch authTier(c, req.URL.Path) {
+		case authNone:
+			next.ServeHTTP(w, req)
+			return
+		case authAdmin:
+			// Never fall back to the shared pair: its default is public
+			if c.AdminUser == "" || c.AdminPass == "" {
+				writeError(w, req, http.StatusForbidden, "admin credentials are not configured")
+				return
+			}
+			wantUser, wantPass, realm = c.AdminUser, c.AdminPass, "Admin"
+		default:
+			if validAPIKey(c, req) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			wantUser, wantPass, realm = c.BasicUser, c.BasicPass, "Restricted"
+		}
+		user, pass, ok := req.BasicAuth()
+		if !ok || !secureEqual(user, wantUser) || !secureEqual(pass, wantPass) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			writeError(w, req, http.StatusUnauthorized, "")
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), userKey{}, user)))
+	})
+}
+
+// validAPIKey reports whether req is for an /api/ path and carries one of
+// conf().APIKeys in its X-API-Key header. Every key is compared so the time
+// taken does not reveal which one matched.
+func validAPIKey(c *Config, req *http.Request) bool {
+	got := req.Header.Get("X-API-Key")
+	if got == "" || !strings.HasPrefix(req.URL.Path, "/api/") {
+		return false
+	}
+	ok := false
+	for _, key := range c.APIKeys {
+		if secureEqual(got, key) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// secureEqual compares credentials in constant time.
+func secureEqual(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
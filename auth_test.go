@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.AdminUser, c.AdminPass = "root", "s3cret"
+		c.AuthRules["/blog"] = authShared
+	})
+	h := authorize(okHandler)
+
+	for _, tt := range []struct {
+		path       string
+		user, pass string
+		want       int
+		realm      string
+	}{
+		{"/about-us", "", "", http.StatusOK, ""},
+		{"/healthz", "", "", http.StatusOK, ""},
+		{"/blog", "", "", http.StatusUnauthorized, `Basic realm="Restricted"`},
+		{"/blog", "admin", "wrong", http.StatusUnauthorized, `Basic realm="Restricted"`},
+		{"/blog", "admin", "0987654321", http.StatusOK, ""},
+		{"/admin/reload", "", "", http.StatusUnauthorized, `Basic realm="Admin"`},
+		{"/admin/reload", "admin", "0987654321", http.StatusUnauthorized, `Basic realm="Admin"`},
+		{"/admin/reload", "root", "s3cret", http.StatusOK, ""},
+		{"/debug/vars", "root", "s3cret", http.StatusOK, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.pass)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s as %q: status %d, want %d", tt.path, tt.user, rec.Code, tt.want)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != tt.realm {
+			t.Errorf("%s as %q: WWW-Authenticate %q, want %q", tt.path, tt.user, got, tt.realm)
+		}
+	}
+}
+
+func TestAuthTier(t *testing.T) {
+	c := &Config{AuthRules: map[string]string{
+		"/admin/":     authAdmin,
+		"/admin/pub/": authNone,
+		"/blog":       authShared,
+	}}
+	for path, want := range map[string]string{
+		"/":              authNone,
+		"/blog/post":     authShared,
+		"/admin/reload":  authAdmin,
+		"/admin/pub/doc": authNone,
+	} {
+		if got := authTier(c, path); got != want {
+			t.Errorf("authTier(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAuthPublic(t *testing.T) {
+	useConfig(t, nil)
+	h := testHandler(t)
+
+	resp := do(t, h, newTestRequest(t, http.MethodGet, "/about-us", nil))
+	assertStatus(t, resp, http.StatusOK)
+	assertContentType(t, resp, "text/html")
+	assertBodyContains(t, resp, "<title>BitVistara</title>")
+
+	// Credentials sent to a public path are ignored, even wrong ones
+	resp = do(t, h, authRequest(t, http.MethodGet, "/about-us", "nobody", "wrong"))
+	assertStatus(t, resp, http.StatusOK)
+}
+
+func TestAuthShared(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.AuthRules["/blog"] = authShared
+	})
+	h := testHandler(t)
+
+	resp := do(t, h, newTestRequest(t, http.MethodGet, "/blog", nil))
+	assertStatus(t, resp, http.StatusUnauthorized)
+	if got := resp.Header.Get("WWW-Authenticate"); got != `Basic realm="Restricted"` {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+	resp = do(t, h, authRequest(t, http.MethodGet, "/blog", "admin", "wrong"))
+	assertStatus(t, resp, http.StatusUnauthorized)
+	resp = do(t, h, authRequest(t, http.MethodGet, "/blog", "admin", "0987654321"))
+	assertStatus(t, resp, http.StatusOK)
+	assertContentType(t, resp, "text/html")
+}
+
+func TestAuthAdmin(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.AdminUser, c.AdminPass = "root", "s3cret"
+	})
+	h := testHandler(t)
+
+	resp := do(t, h, newTestRequest(t, http.MethodPost, "/admin/reload", nil))
+	assertStatus(t, resp, http.StatusUnauthorized)
+	if got := resp.Header.Get("WWW-Authenticate"); got != `Basic realm="Admin"` {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+	// The shared pair is never enough for the admin tier
+	resp = do(t, h, authRequest(t, http.MethodPost, "/admin/reload", "admin", "0987654321"))
+	assertStatus(t, resp, http.StatusUnauthorized)
+	resp = do(t, h, authRequest(t, http.MethodPost, "/admin/reload", "root", "s3cret"))
+	assertStatus(t, resp, http.StatusNoContent)
+}
+
+func TestAuthAdminUnset(t *testing.T) {
+	useConfig(t, nil)
+	h := testHandler(t)
+
+	// Without admin_user and admin_pass the admin tier refuses everyone,
+	// including the shared pair published as the default
+	for _, req := range []*http.Request{
+		newTestRequest(t, http.MethodPost, "/admin/reload", nil),
+		authRequest(t, http.MethodPost, "/admin/reload", "admin", "0987654321"),
+		authRequest(t, http.MethodPost, "/admin/reload", "", ""),
+	} {
+		assertStatus(t, do(t, h, req), http.StatusForbidden)
+	}
+}
+
+func TestAuthAPIKey(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.AuthRules["/api/"] = authShared
+		c.AuthRules["/blog"] = authShared
+		c.APIKeys = []string{"key-one", "key-two"}
+	})
+	h := testHandler(t)
+
+	withKey := func(path, key string) *http.Request {
+		req := newTestRequest(t, http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", key)
+		return req
+	}
+	// Past authorize there is no /api/ route, so an accepted key gets a 404
+	assertStatus(t, do(t, h, withKey("/api/items", "key-two")), http.StatusNotFound)
+	assertStatus(t, do(t, h, withKey("/api/items", "key-three")), http.StatusUnauthorized)
+	assertStatus(t, do(t, h, newTestRequest(t, http.MethodGet, "/api/items", nil)), http.StatusUnauthorized)
+	// Keys are only honoured under /api/
+	assertStatus(t, do(t, h, withKey("/blog", "key-one")), http.StatusUnauthorized)
+}
+
+func TestAuthOverNetwork(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.AuthRules["/blog"] = authShared
+	})
+	srv := httptest.NewServer(testHandler(t))
+	defer srv.Close()
+
+	assertStatus(t, do(t, nil, newTestRequest(t, http.MethodGet, srv.URL+"/blog", nil)), http.StatusUnauthorized)
+	resp := do(t, nil, authRequest(t, http.MethodGet, srv.URL+"/blog", "admin", "0987654321"))
+	assertStatus(t, resp, http.StatusOK)
+	assertContentType(t, resp, "text/html")
+}
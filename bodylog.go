@@ -0,0 +1,120 @@
+//go:build debug
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// logBodies logs the request and response bodies of /api/ requests at debug
+// level when conf().DebugBodies is set, each capped at DebugBodyMaxBytes.
+// JSON fields named in conf().DebugRedactFields are masked; JSON that
+// cannot be parsed, for instance because it was cut at the cap, is not
+// logged at all so a masked field cannot leak. Bodies are buffered only up
+// to the cap, and the request body is handed on intact.
+func logBodies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c := conf()
+		if !c.DebugBodies || !strings.HasPrefix(req.URL.Path, "/api/") {
+			next.ServeHTTP(w, req)
+			return
+		}
+		max := c.DebugBodyMaxBytes
+		head, _ := io.ReadAll(io.LimitReader(req.Body, int64(max)+1))
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), req.Body), req.Body}
+
+		tee := &bodyTee{ResponseWriter: w, max: max}
+		next.ServeHTTP(tee, req)
+
+		slog.Debug("api bodies",
+			"method", req.Method,
+			"path", req.URL.Path,
+			"request", loggableBody(c, req.Header, head),
+			"response", loggableBody(c, w.Header(), tee.buf.Bytes()),
+		)
+	})
+}
+
+// bodyTee copies the first max bytes of a response aside.
+type bodyTee struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+	max int
+}
+
+func (t *bodyTee) Write(b []byte) (int, error) {
+	if room := t.max + 1 - t.buf.Len(); room > 0 {
+		t.buf.Write(b[:min(room, len(b))])
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *bodyTee) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *bodyTee) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// loggableBody returns the body b (at most DebugBodyMaxBytes+1 bytes) as it
+// may be logged.
+func loggableBody(c *Config, h http.Header, b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	if h.Get("Content-Encoding") != "" {
+		return "[encoded body omitted]"
+	}
+	truncated := len(b) > c.DebugBodyMaxBytes
+	if truncated {
+		b = b[:c.DebugBodyMaxBytes]
+	}
+	if mt, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mt == "application/json" || strings.HasSuffix(mt, "+json") {
+		var v any
+		if truncated || json.Unmarshal(b, &v) != nil {
+			return "[unparsed JSON omitted]"
+		}
+		out, _ := json.Marshal(redactJSON(v, c.DebugRedactFields))
+		return string(out)
+	}
+	if truncated {
+		return string(b) + "…"
+	}
+	return string(b)
+}
+
+// redactJSON masks the values of object keys matching fields, at any depth.
+func redactJSON(v any, fields []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			masked := false
+			for _, f := range fields {
+				if strings.EqualFold(k, f) {
+					v[k], masked = redacted, true
+					break
+				}
+			}
+			if !masked {
+				v[k] = redactJSON(val, fields)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactJSON(v[i], fields)
+		}
+	}
+	return v
+}
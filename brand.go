@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Branding is the per-deployment identity exposed to templates as .Brand.
+// Logo and Favicon are URL paths under /public/; an empty Logo keeps the
+// built-in "BV" mark.
+type Branding struct {
+	Name         string `json:"name"`          // BRAND_NAME
+	Logo         string `json:"logo"`          // BRAND_LOGO
+	PrimaryColor string `json:"primary_color"` // BRAND_PRIMARY_COLOR, e.g. #ec1313
+	Favicon      string `json:"favicon"`       // BRAND_FAVICON
+
+	// ShortName and Icons are used by the web app manifest; ShortName
+	// defaults to Name and Icons to the favicon. Icons are config file only.
+	ShortName string      `json:"short_name"` // BRAND_SHORT_NAME
+	Icons     []BrandIcon `json:"icons"`
+}
+
+// BrandIcon is an app icon under /public/ listed in the web app manifest.
+type BrandIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`          // e.g. "192x192", or "any" for SVG
+	Type  string `json:"type,omitempty"` // MIME type, e.g. image/png
+}
+
+var hexColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// manifestHandler serves the web app manifest at /manifest.webmanifest,
+// generated from conf().Brand so the site can be installed as an app.
+func manifestHandler(w http.ResponseWriter, req *http.Request) {
+	b := conf().Brand
+	icons := slices.Clone(b.Icons)
+	if len(icons) == 0 && b.Favicon != "" {
+		icons = []BrandIcon{{Src: b.Favicon, Sizes: "any", Type: mime.TypeByExtension(path.Ext(b.Favicon))}}
+	}
+	publicDir := siteFrom(req).PublicDir
+	for i := range icons {
+		icons[i].Src = sitePath(assetURL(publicDir, icons[i].Src))
+	}
+	shortName := b.ShortName
+	if shortName == "" {
+		shortName = b.Name
+	}
+	w.Header().Set("Content-Type", "application/manifest+json")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	json.NewEncoder(w).Encode(map[string]any{
+		"name":             b.Name,
+		"short_name":       shortName,
+		"start_url":        sitePath("/"),
+		"scope":            sitePath("/"),
+		"display":          "standalone",
+		"theme_color":      b.PrimaryColor,
+		"background_color": "#f8f6f6",
+		"icons":            icons,
+	})
+}
+
+// faviconHandler serves conf().Brand.Favicon from the site's public
+// directory at /favicon.ico, for clients that ask for it without reading
+// the page's <link rel="icon">.
+func faviconHandler(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(conf().Brand.Favicon, "/public")
+	if name == "" {
+		writeError(w, req, http.StatusNotFound, "")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(w, req, filepath.Join(siteFrom(req).PublicDir, filepath.FromSlash(path.Clean(name))))
+}
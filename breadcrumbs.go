@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// breadcrumb is one step of a page's trail, exposed to templates as
+// .Breadcrumbs.
+type breadcrumb struct {
+	Label   string
+	URL     string
+	Current bool // the page being viewed, always the last crumb
+}
+
+// breadcrumbs builds the trail for path, starting at Home and adding one
+// crumb per segment. Segments are labelled from conf().BreadcrumbLabels or
+// by humanizing the segment; title, when set, labels the last crumb
+// instead (e.g. a post title for /blog/{slug}). The home page has no trail.
+func breadcrumbs(path, title string) []breadcrumb {
+	segments := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	if len(segments) == 0 {
+		return nil
+	}
+	labels := conf().BreadcrumbLabels
+	trail := []breadcrumb{{Label: "Home", URL: "/"}}
+	url := ""
+	for i, seg := range segments {
+		url += "/" + seg
+		label, ok := labels[seg]
+		if !ok {
+			label = humanize(seg)
+		}
+		if i == len(segments)-1 && title != "" {
+			label = title
+		}
+		trail = append(trail, breadcrumb{Label: label, URL: url, Current: i == len(segments)-1})
+	}
+	return trail
+}
+
+// humanize turns a path segment such as "linux-commands" into
+// "Linux Commands".
+func humanize(seg string) string {
+	words := strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' })
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+// breadcrumbListLD returns trail as a schema.org BreadcrumbList for a JSON-LD
+// script tag, with URLs made absolute against the site's origin.
+func breadcrumbListLD(req *http.Request, trail []breadcrumb) map[string]any {
+	if len(trail) == 0 {
+		return nil
+	}
+	origin := siteURL(req)
+	items := make([]map[string]any, len(trail))
+	for i, c := range trail {
+		items[i] = map[string]any{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"name":     c.Label,
+			"item":     origin + c.URL,
+		}
+	}
+	return map[string]any{
+		"@context":        "https://schema.org",
+		"@type":           "BreadcrumbList",
+		"itemListElement": items,
+	}
+}
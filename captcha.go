@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// captchaProvider describes a captcha service's widget and verify endpoint.
+type captchaProvider struct {
+	Script    string // widget script URL
+	Class     string // CSS class of the widget container
+	Field     string // form field carrying the response token
+	VerifyURL string
+}
+
+var captchaProviders = map[string]captchaProvider{
+	"hcaptcha": {
+		Script:    "https://js.hcaptcha.com/1/api.js",
+		Class:     "h-captcha",
+		Field:     "h-captcha-response",
+		VerifyURL: "https://api.hcaptcha.com/siteverify",
+	},
+	"recaptcha": {
+		Script:    "https://www.google.com/recaptcha/api.js",
+		Class:     "g-recaptcha",
+		Field:     "g-recaptcha-response",
+		VerifyURL: "https://www.google.com/recaptcha/api/siteverify",
+	},
+}
+
+// captchaWidget is the template data needed to render the captcha widget.
+type captchaWidget struct {
+	Script  string
+	Class   string
+	SiteKey string
+}
+
+// captchaTemplateData returns the widget data, or nil when captcha
+// verification is disabled (no secret configured).
+func captchaTemplateData() *captchaWidget {
+	c := conf()
+	if c.CaptchaSecret == "" {
+		return nil
+	}
+	p := captchaProviders[c.CaptchaProvider]
+	return &captchaWidget{Script: p.Script, Class: p.Class, SiteKey: c.CaptchaSiteKey}
+}
+
+// errCaptchaUnavailable reports that the verification service could not be
+// reached in time, as opposed to the token being rejected.
+var errCaptchaUnavailable = errors.New("captcha verification unavailable")
+
+// verifyCaptcha checks the captcha token submitted with the parsed form in
+// req. It always succeeds when verification is disabled.
+func verifyCaptcha(ctx context.Context, req *http.Request) (bool, error) {
+	c := conf()
+	if c.CaptchaSecret == "" {
+		return true, nil
+	}
+	p := captchaProviders[c.CaptchaProvider]
+	token := req.PostForm.Get(p.Field)
+	if token == "" {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	form := url.Values{
+		"secret":   {c.CaptchaSecret},
+		"response": {token},
+		"remoteip": {clientIP(req)},
+	}
+	vreq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	vreq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(vreq)
+	if err != nil {
+		return false, errors.Join(errCaptchaUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, errCaptchaUnavailable
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, errors.Join(errCaptchaUnavailable, err)
+	}
+	return result.Success, nil
+}
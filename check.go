@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// check parses every template of every configured site and verifies that
+// each entry in pages resolves to a template, so a broken view can be caught
+// before deploying. Templates are parsed, not executed.
+func check(args []string) error {
+	c, err := loadConfig(flag.NewFlagSet("check", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	current.Store(c)
+
+	sites := sitesOf(c)
+	hosts := make([]string, 0, len(sites))
+	for host := range sites {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var errs []error
+	checked := 0
+	for _, host := range hosts {
+		n, err := checkSite(sites[host])
+		checked += n
+		if err != nil {
+			if host != "" {
+				err = fmt.Errorf("%s: %w", host, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	fmt.Printf("ok: %d templates in %d site(s)\n", checked, len(hosts))
+	return nil
+}
+
+// checkSite parses the templates under the site's view directories the way
+// renderStatus would and returns how many it checked. A template shadowed
+// by one in an earlier directory is skipped, as it is never rendered.
+func checkSite(site Site) (int, error) {
+	var errs []error
+	base, _ := site.viewPath("layout/base.html")
+	seen := map[string]bool{}
+	checked := 0
+	for _, dir := range site.viewDirs() {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, path)
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if rel == "layout" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if _, err := resolveTemplatePath(rel); err != nil || seen[rel] {
+				return nil
+			}
+			seen[rel] = true
+			files := []string{path}
+			if strings.HasPrefix(rel, "pages/") {
+				files = []string{base, path}
+			}
+			checked++
+			if _, err := parseTemplate(files...); err != nil {
+				errs = append(errs, err)
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, p := range pages {
+		if path, ok := site.viewPath(p.Template); !ok {
+			errs = append(errs, fmt.Errorf("page %s (%s): %s not found", p.Name, p.Path, path))
+		}
+	}
+	return checked, errors.Join(errs...)
+}
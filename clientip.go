@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIP returns the IP address of the client that sent req. When the
+// direct peer is one of conf().TrustedProxies, X-Forwarded-For is walked
+// from the right and the first hop that is not a trusted proxy wins;
+// otherwise the header is ignored so clients cannot spoof their address.
+func clientIP(req *http.Request) string {
+	host := remoteHost(req)
+	if !trustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// Anything left of a garbled entry can't be trusted either.
+			return host
+		}
+		if !trustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+// remoteHost returns the IP address of the direct peer of req.
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// trustedProxy reports whether ip falls in one of conf().TrustedProxies.
+func trustedProxy(ip string) bool {
+	return inPrefixes(ip, conf().proxies)
+}
+
+// inPrefixes reports whether ip parses and falls in one of prefixes.
+func inPrefixes(ip string, prefixes []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
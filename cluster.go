@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clearCaches drops the template, asset hash and sitemap caches so edited
+// files are picked up, re-hashing the static files in the background.
+func clearCaches() {
+	resetTemplateCache()
+	resetAssetHashes()
+	go precomputeAssetHashes(staticDirs(conf()))
+	resetSitemapCache()
+}
+
+// clusterSignal holds the token last read from or written to
+// conf().ClusterSignal, including this instance's own signals. Each signal
+// writes a new token, so a rewrite is noticed even when the file system's
+// coarse timestamps leave the modification time unchanged.
+var clusterSignal struct {
+	sync.Mutex
+	seen string
+}
+
+// signalCluster asks every instance sharing conf().ClusterSignal to clear
+// its caches by rewriting the file with a new token. It does nothing when
+// the setting is empty, so a single instance behaves as before.
+func signalCluster() {
+	file := conf().ClusterSignal
+	if file == "" {
+		return
+	}
+	token := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(file, []byte(token+"\n"), 0o644); err != nil {
+		log.Printf("cluster signal %s: %v", file, err)
+		return
+	}
+	clusterSignal.Lock()
+	clusterSignal.seen = token
+	clusterSignal.Unlock()
+}
+
+// clusterSignaled reports whether file holds a token other than the one
+// last seen, recording it. A missing or unreadable file reports false.
+func clusterSignaled(file string) bool {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	token := strings.TrimSpace(string(b))
+	clusterSignal.Lock()
+	defer clusterSignal.Unlock()
+	if token == clusterSignal.seen {
+		return false
+	}
+	clusterSignal.seen = token
+	return true
+}
+
+// watchClusterSignal polls conf().ClusterSignal every ClusterPollSec until
+// ctx is done and clears the caches when another instance has rewritten it.
+// A missing file is not an error; it appears with the first signal.
+func watchClusterSignal(ctx context.Context) {
+	clusterSignaled(conf().ClusterSignal) // the token present at startup is old news
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(conf().ClusterPoll()):
+		}
+		file := conf().ClusterSignal
+		if file == "" {
+			continue
+		}
+		if clusterSignaled(file) {
+			clearCaches()
+			log.Printf("reload: template and asset caches cleared by cluster signal %s", file)
+		}
+	}
+}
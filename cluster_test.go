@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClusterSignalSameMtime(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reload")
+	useConfig(t, func(c *Config) { c.ClusterSignal = file })
+
+	signalCluster()
+	if clusterSignaled(file) {
+		t.Fatal("own signal reported as a new one")
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance signals within the same timestamp tick
+	if err := os.WriteFile(file, []byte("12345-1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, time.Time{}, info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if !clusterSignaled(file) {
+		t.Fatal("rewrite with an unchanged mtime not noticed")
+	}
+	if clusterSignaled(file) {
+		t.Fatal("the same signal reported twice")
+	}
+}
@@ -0,0 +1,1041 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds all server settings. Values are layered: built-in defaults,
+// then the JSON config file (-config or CONFIG_FILE), then environment
+// variables, then command-line flags.
+type Config struct {
+	Addr    string `json:"addr"`     // ADDR, -addr
+	BaseURL string `json:"base_url"` // BASE_URL, -base-url
+
+	// BasePath serves the whole site under a subpath such as "/docs" behind
+	// a reverse proxy. Empty (or "/") serves it at the root.
+	BasePath string `json:"base_path"` // BASE_PATH
+
+	// Basic auth: the shared credentials, and stronger admin credentials;
+	// the admin tier refuses every request until both admin fields are set.
+	// AuthRules maps path prefixes to the tier required there: none, shared
+	// or admin; the longest matching prefix wins and unmatched paths are
+	// public. Rules from the file or AUTH_RULES ("/prefix=tier,...") add to
+	// the defaults.
+	BasicUser string            `json:"basic_user"` // BASIC_USER
+	BasicPass string            `json:"basic_pass"` // BASIC_PASS
+	AdminUser string            `json:"admin_user"` // ADMIN_USER
+	AdminPass string            `json:"admin_pass"` // ADMIN_PASS
+	AuthRules map[string]string `json:"auth_rules"` // AUTH_RULES
+
+	// APIKeys are accepted in an X-API-Key header instead of the shared
+	// basic auth credentials on /api/ paths.
+	APIKeys []string `json:"api_keys"` // API_KEYS (comma-separated)
+
+	WarmupRoutes  []string `json:"warmup_routes"`  // WARMUP_ROUTES (comma-separated)
+	WarmupWorkers int      `json:"warmup_workers"` // WARMUP_WORKERS
+
+	SlowRenderMS      int  `json:"slow_render_ms"`     // SLOW_RENDER_MS
+	TemplateCache     bool `json:"template_cache"`     // TEMPLATE_CACHE
+	FallbackTemplates bool `json:"fallback_templates"` // FALLBACK_TEMPLATES
+	StrictTemplates   bool `json:"strict_templates"`   // STRICT_TEMPLATES: missing map keys fail the render; for development
+	Minify            bool `json:"minify"`             // MINIFY: collapse whitespace and drop comments in rendered HTML
+
+	// TemplateDelims are the action delimiters for every template under the
+	// view directories, e.g. ["[[", "]]"] so pages can show "{{" literally.
+	TemplateDelims []string `json:"template_delims"` // TEMPLATE_DELIMS, e.g. "[[,]]"
+
+	// DateFormats and PrintfFormats declare extra template functions: each
+	// name maps to a Go time layout ({{shortDate .Date}} formats in
+	// DisplayTZ) or a printf format ({{price .Amount}}). Config file only.
+	DateFormats   map[string]string `json:"date_formats"`
+	PrintfFormats map[string]string `json:"printf_formats"`
+	SitemapPing   bool              `json:"sitemap_ping"` // SITEMAP_PING
+
+	// ClusterSignal is a file shared by all instances, e.g. on NFS:
+	// /admin/reload writes a new token to it and every instance that sees
+	// the token change clears its caches too. Empty keeps reloads local.
+	ClusterSignal  string `json:"cluster_signal"`   // CLUSTER_SIGNAL
+	ClusterPollSec int    `json:"cluster_poll_sec"` // CLUSTER_POLL_SEC
+
+	// ExportDir is where the export command and POST /admin/export write
+	// the rendered site as static files.
+	ExportDir string `json:"export_dir"` // EXPORT_DIR
+
+	// SitemapSections sets changefreq and priority per page section (see
+	// pages.go). Config file only.
+	SitemapSections map[string]SitemapSection `json:"sitemap_sections"`
+
+	// Brand is the site name, logo, primary color and favicon used by the
+	// layouts.
+	Brand Branding `json:"brand"`
+
+	// BreadcrumbLabels maps path segments to breadcrumb labels where
+	// humanizing the segment reads badly. Config file only.
+	BreadcrumbLabels map[string]string `json:"breadcrumb_labels"`
+
+	// SitemapCacheTTLSec bounds how long a generated sitemap is reused; 0
+	// regenerates it on every request.
+	SitemapCacheTTLSec int `json:"sitemap_cache_ttl_sec"` // SITEMAP_CACHE_TTL_SEC
+
+	// CSP is the Content-Security-Policy header; "{nonce}" is replaced by a
+	// per-response nonce that templates get from cspNonce. Empty disables it.
+	CSP string `json:"csp"` // CSP
+
+	// HSTS sends Strict-Transport-Security on HTTPS requests, including
+	// those a trusted proxy forwards with X-Forwarded-Proto: https.
+	HSTS                  bool `json:"hsts"`                    // HSTS
+	HSTSMaxAgeSec         int  `json:"hsts_max_age_sec"`        // HSTS_MAX_AGE_SEC
+	HSTSIncludeSubdomains bool `json:"hsts_include_subdomains"` // HSTS_INCLUDE_SUBDOMAINS
+	HSTSPreload           bool `json:"hsts_preload"`            // HSTS_PRELOAD
+
+	// CustomHeaders are "Key: Value" lines added to every response.
+	CustomHeaders string `json:"custom_headers"` // CUSTOM_HEADERS or CUSTOM_HEADERS_FILE
+
+	LogLevel string `json:"log_level"` // LOG_LEVEL: debug, info, warn or error
+
+	// LogSampleRate is the fraction of fast 2xx requests written to the
+	// access log; errors and slow requests are always logged.
+	LogSampleRate float64 `json:"log_sample_rate"` // LOG_SAMPLE_RATE
+
+	// LogFields are the access log fields, from accessLogFields or
+	// "header:<Name>" for a request header. Values of LogRedactHeaders and of
+	// the LogRedactQuery parameters ("*" for all) are replaced by
+	// "[redacted]".
+	LogFields        []string `json:"log_fields"`         // LOG_FIELDS (comma-separated)
+	LogRedactQuery   []string `json:"log_redact_query"`   // LOG_REDACT_QUERY (comma-separated)
+	LogRedactHeaders []string `json:"log_redact_headers"` // LOG_REDACT_HEADERS (comma-separated)
+
+	// DebugBodies logs /api/ request and response bodies at debug level,
+	// up to DebugBodyMaxBytes each, masking DebugRedactFields in JSON, and
+	// the fields of each contact form submission. For troubleshooting only:
+	// it buffers bodies and may log personal data.
+	DebugBodies       bool     `json:"debug_bodies"`         // DEBUG_BODIES
+	DebugBodyMaxBytes int      `json:"debug_body_max_bytes"` // DEBUG_BODY_MAX_BYTES
+	DebugRedactFields []string `json:"debug_redact_fields"`  // DEBUG_REDACT_FIELDS (comma-separated)
+
+	// Gzip compresses responses of at least GzipMinBytes for clients that
+	// accept it.
+	Gzip         bool `json:"gzip"`           // GZIP
+	GzipMinBytes int  `json:"gzip_min_bytes"` // GZIP_MIN_BYTES
+
+	// AllowedMethods are the only request methods served; others get a
+	// 405 before routing.
+	AllowedMethods []string `json:"allowed_methods"` // ALLOWED_METHODS (comma-separated)
+
+	// MaxURLLen caps the length of the request path and query; longer
+	// requests get a 414. 0 disables the check.
+	MaxURLLen int `json:"max_url_len"` // MAX_URL_LEN
+
+	// MaxDecompressedBytes caps gzip/deflate request bodies after decoding.
+	MaxDecompressedBytes int64 `json:"max_decompressed_bytes"` // MAX_DECOMPRESSED_BYTES
+
+	// NotFoundSuggestions is how many similar pages the 404 page offers;
+	// 0 turns suggestions off.
+	NotFoundSuggestions int `json:"not_found_suggestions"` // NOT_FOUND_SUGGESTIONS
+
+	// Maintenance serves the maintenance page to every request. Outside of
+	// that switch, a window given as RFC 3339 times turns maintenance on
+	// automatically between MaintenanceStart and MaintenanceEnd.
+	Maintenance      bool   `json:"maintenance"`       // MAINTENANCE
+	MaintenanceStart string `json:"maintenance_start"` // MAINTENANCE_START
+	MaintenanceEnd   string `json:"maintenance_end"`   // MAINTENANCE_END
+
+	// Sites maps host names to their own view and public directories for
+	// serving several sites from one process. Requests for other hosts go to
+	// DefaultHost's site, or get a 404 when it is unset. Config file only.
+	Sites       map[string]Site `json:"sites"`
+	DefaultHost string          `json:"default_host"`
+
+	// ViewDirs are the single site's view directories, first match wins,
+	// e.g. an overlay before the theme. Empty uses view/. See Site.
+	ViewDirs []string `json:"view_dirs"` // VIEW_DIRS (colon-separated)
+
+	// StaticMounts serve more directories next to /public/, each with its
+	// own cache policy. Config file only.
+	StaticMounts []StaticMount `json:"static_mounts"`
+
+	// Redirects are applied before routing; see Redirect. REDIRECTS adds
+	// 301s as "/from=/to,/old/*=/new/*".
+	Redirects []Redirect `json:"redirects"` // REDIRECTS
+
+	// RateLimitRefresh makes the 429 page reload by itself once
+	// Retry-After has passed, unless it is showing a rejected form post.
+	RateLimitRefresh bool `json:"rate_limit_refresh"` // RATE_LIMIT_REFRESH
+
+	// ServerTiming sends a Server-Timing header with the render time and
+	// any spans handlers record with recordTiming. Pages are buffered while
+	// it is on.
+	ServerTiming bool `json:"server_timing"` // SERVER_TIMING
+
+	// PWA serves a generated service worker at /sw.js, which precaches
+	// the shell assets and shows /offline.html when a page can't load.
+	PWA bool `json:"pwa"` // PWA
+
+	// Features are the default values of the boolean feature flags that
+	// handlers check with featureEnabled and templates with feature;
+	// authenticated users can override them per request. Config file only.
+	Features map[string]bool `json:"features"`
+
+	// Gone lists paths of removed content answered with 410 Gone; see
+	// goneMatch for the pattern forms.
+	Gone []string `json:"gone"` // GONE (comma-separated)
+
+	// ServerHeader is sent as the Server header; empty omits it. Any
+	// X-Powered-By header is always removed.
+	ServerHeader string `json:"server_header"` // SERVER_HEADER
+
+	// RequireDirs makes serve exit when a site's view or public directory
+	// is missing instead of logging a warning.
+	RequireDirs bool `json:"require_dirs"` // REQUIRE_DIRS
+
+	// Contact form throttling per client IP. ContactRate (submissions per
+	// hour, 0 to disable) refills a token bucket holding up to ContactBurst.
+	ContactMinIntervalSec int     `json:"contact_min_interval_sec"` // CONTACT_MIN_INTERVAL_SEC
+	ContactDailyCap       int     `json:"contact_daily_cap"`        // CONTACT_DAILY_CAP
+	ContactRate           float64 `json:"contact_rate"`             // CONTACT_RATE
+	ContactBurst          int     `json:"contact_burst"`            // CONTACT_BURST
+
+	// Captcha verification on the contact form; disabled without a secret.
+	CaptchaProvider string `json:"captcha_provider"` // CAPTCHA_PROVIDER: hcaptcha or recaptcha
+	CaptchaSiteKey  string `json:"captcha_site_key"` // CAPTCHA_SITE_KEY
+	CaptchaSecret   string `json:"captcha_secret"`   // CAPTCHA_SECRET
+
+	// DefaultLang is the page language for <html lang>, unless the site
+	// sets its own; languages in RTLLangs are rendered right-to-left.
+	DefaultLang string   `json:"default_lang"` // DEFAULT_LANG
+	RTLLangs    []string `json:"rtl_langs"`    // RTL_LANGS (comma-separated)
+
+	// Env names the deployment environment; some features, such as the
+	// analytics snippet, only run in "production".
+	Env string `json:"env"` // ENV
+
+	// Analytics injects a provider's script into every page in production;
+	// disabled without a provider.
+	AnalyticsProvider string `json:"analytics_provider"` // ANALYTICS_PROVIDER: plausible or goatcounter
+	AnalyticsSiteID   string `json:"analytics_site_id"`  // ANALYTICS_SITE_ID
+
+	// ImageWidths are the ?w= values accepted for on-the-fly image resizing.
+	ImageWidths   []int  `json:"image_widths"`    // IMAGE_WIDTHS (comma-separated)
+	ImageCacheDir string `json:"image_cache_dir"` // IMAGE_CACHE_DIR
+	WebP          bool   `json:"webp"`            // WEBP: serve WebP variants to browsers that accept them
+
+	// TrustedProxies are the CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header is believed when working out the client IP.
+	TrustedProxies []string `json:"trusted_proxies"` // TRUSTED_PROXIES (comma-separated)
+
+	// AdminAllowCIDRs limits /admin/ and /debug/ routes to these networks,
+	// on top of basic auth. Empty allows any address.
+	AdminAllowCIDRs []string `json:"admin_allow_cidrs"` // ADMIN_ALLOW_CIDRS (comma-separated)
+
+	// Outgoing email for contact form submissions; unset SMTPAddr only logs
+	// them. Each message is tried MailAttempts times, waiting MailBackoffMS
+	// and doubling after every failure, within MailTimeoutSec overall.
+	// Messages that still fail are saved as JSON to FailedMailDir. Up to
+	// MailQueueSize messages wait in the background outbox.
+	SMTPAddr       string   `json:"smtp_addr"`        // SMTP_ADDR, host:port
+	SMTPUser       string   `json:"smtp_user"`        // SMTP_USER
+	SMTPPass       string   `json:"smtp_pass"`        // SMTP_PASS
+	MailFrom       string   `json:"mail_from"`        // MAIL_FROM
+	MailTo         []string `json:"mail_to"`          // MAIL_TO (comma-separated)
+	MailAttempts   int      `json:"mail_attempts"`    // MAIL_ATTEMPTS
+	MailBackoffMS  int      `json:"mail_backoff_ms"`  // MAIL_BACKOFF_MS
+	MailTimeoutSec int      `json:"mail_timeout_sec"` // MAIL_TIMEOUT_SEC
+	FailedMailDir  string   `json:"failed_mail_dir"`  // FAILED_MAIL_DIR
+	MailQueueSize  int      `json:"mail_queue_size"`  // MAIL_QUEUE_SIZE
+
+	// ShutdownTimeoutSec bounds how long SIGTERM waits for in-flight
+	// requests before closing them.
+	ShutdownTimeoutSec int `json:"shutdown_timeout_sec"` // SHUTDOWN_TIMEOUT_SEC
+
+	// Readiness checks behind /readyz. Each optional check has its own
+	// switch so a deployment without that dependency still reports ready.
+	ReadyTimeoutMS int  `json:"ready_timeout_ms"` // READY_TIMEOUT_MS: deadline for all checks together
+	ReadyCheckSMTP bool `json:"ready_check_smtp"` // READY_CHECK_SMTP: TCP-dial smtp_addr
+
+	// StartupGate answers requests other than the probes with a 503 and
+	// Retry-After until the startup warm-up finishes.
+	StartupGate bool `json:"startup_gate"` // STARTUP_GATE
+
+	// ProxyTarget is the upstream that requests under ProxyPrefix are
+	// forwarded to, with the prefix stripped. Empty disables the proxy.
+	ProxyPrefix string `json:"proxy_prefix"` // PROXY_PREFIX
+	ProxyTarget string `json:"proxy_target"` // PROXY_TARGET
+
+	// Connection pool of the proxy's transport, sized for a small backend.
+	ProxyMaxIdleConns       int `json:"proxy_max_idle_conns"`        // PROXY_MAX_IDLE_CONNS
+	ProxyIdleConnTimeoutSec int `json:"proxy_idle_conn_timeout_sec"` // PROXY_IDLE_CONN_TIMEOUT_SEC
+	ProxyDialTimeoutMS      int `json:"proxy_dial_timeout_ms"`       // PROXY_DIAL_TIMEOUT_MS
+
+	// ReadyCheckProxy makes /readyz request ProxyHealthPath from the
+	// upstream, so the instance only turns ready once the backend answers.
+	ReadyCheckProxy bool   `json:"ready_check_proxy"` // READY_CHECK_PROXY
+	ProxyHealthPath string `json:"proxy_health_path"` // PROXY_HEALTH_PATH
+
+	// DisplayTZ is the IANA time zone dates are shown in (formatDate, the
+	// sitemap, the maintenance page). A zone that cannot be loaded falls
+	// back to UTC with a warning.
+	DisplayTZ string `json:"display_tz"` // DISPLAY_TZ
+
+	headers     http.Header    // parsed CustomHeaders
+	proxies     []netip.Prefix // parsed TrustedProxies
+	adminNets   []netip.Prefix // parsed AdminAllowCIDRs
+	proxyTarget *url.URL       // parsed ProxyTarget
+	location    *time.Location // loaded DisplayTZ
+}
+
+// defaultConfig returns the settings used when nothing is configured.
+func defaultConfig() *Config {
+	return &Config{
+		Addr:      ":9090",
+		BasicUser: "admin",
+		BasicPass: "0987654321",
+		AuthRules: map[string]string{
+			"/admin/":               authAdmin,
+			"/debug/":               authAdmin,
+			"/.well-known/":         authNone,
+			"/healthz":              authNone,
+			"/readyz":               authNone,
+			"/sw.js":                authNone,
+			"/offline.html":         authNone,
+			"/manifest.webmanifest": authNone,
+		},
+		WarmupRoutes:      []string{"/", "/about-us", "/services", "/training", "/blog", "/contact"},
+		WarmupWorkers:     4,
+		SlowRenderMS:      200,
+		TemplateCache:     true,
+		TemplateDelims:    []string{"{{", "}}"},
+		FallbackTemplates: true,
+		Brand: Branding{
+			Name:         "BitVistara",
+			PrimaryColor: "#ec1313",
+			Favicon:      "/public/favicon.svg",
+		},
+		BreadcrumbLabels: map[string]string{
+			"golang": "Go",
+			"devops": "DevOps",
+			"ai-ml":  "AI/ML",
+		},
+		SitemapSections: map[string]SitemapSection{
+			"main":     {ChangeFreq: "weekly", Priority: 0.8},
+			"blog":     {ChangeFreq: "daily", Priority: 0.7},
+			"training": {ChangeFreq: "monthly", Priority: 0.6},
+			"roadmaps": {ChangeFreq: "monthly", Priority: 0.5},
+		},
+		CSP: "default-src 'self'; script-src 'self' 'nonce-{nonce}' 'strict-dynamic' https:; " +
+			"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; font-src 'self' https://fonts.gstatic.com; " +
+			"img-src 'self' data: https:; connect-src 'self' https:; frame-src https:; object-src 'none'; base-uri 'self'",
+		HSTSMaxAgeSec:           31536000,
+		LogLevel:                "info",
+		LogSampleRate:           1,
+		LogFields:               []string{"method", "path", "ip", "status", "size", "duration", "render"},
+		LogRedactHeaders:        []string{"Authorization", "Cookie", "Proxy-Authorization"},
+		DebugBodyMaxBytes:       4096,
+		DebugRedactFields:       []string{"password", "token", "secret", "api_key"},
+		ProxyPrefix:             "/api/backend",
+		ProxyMaxIdleConns:       16,
+		ProxyIdleConnTimeoutSec: 90,
+		ProxyDialTimeoutMS:      5000,
+		ProxyHealthPath:         "/",
+		ReadyTimeoutMS:          2000,
+		MailAttempts:            3,
+		MailBackoffMS:           1000,
+		MailTimeoutSec:          30,
+		MailQueueSize:           100,
+		DisplayTZ:               "UTC",
+		NotFoundSuggestions:     3,
+		ShutdownTimeoutSec:      30,
+		SitemapCacheTTLSec:      3600,
+		ClusterPollSec:          5,
+		MaxDecompressedBytes:    10 << 20,
+		MaxURLLen:               2048,
+		AllowedMethods:          []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions},
+		Gzip:                    true,
+		GzipMinBytes:            1024,
+
+		ContactMinIntervalSec: 30,
+		ContactDailyCap:       5,
+		ContactRate:           3,
+		ContactBurst:          3,
+		CaptchaProvider:       "hcaptcha",
+
+		Env:              "development",
+		DefaultLang:      "en",
+		RTLLangs:         []string{"ar", "he", "fa", "ur"},
+		RateLimitRefresh: true,
+
+		ImageWidths:   []int{320, 640, 960, 1280},
+		ImageCacheDir: filepath.Join(os.TempDir(), "bitvistara-images"),
+	}
+}
+
+// current holds the active configuration. It is swapped atomically on
+// SIGHUP, so read it through conf() on every use rather than caching it.
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(defaultConfig())
+}
+
+// conf returns the active configuration.
+func conf() *Config {
+	return current.Load()
+}
+
+// restartOnly lists settings (by JSON key) that cannot change while the
+// server is running.
+var restartOnly = map[string]bool{
+	"addr":                        true,
+	"base_path":                   true,
+	"sites":                       true,
+	"static_mounts":               true,
+	"view_dirs":                   true,
+	"proxy_prefix":                true,
+	"proxy_max_idle_conns":        true,
+	"proxy_idle_conn_timeout_sec": true,
+	"proxy_dial_timeout_ms":       true,
+	"default_host":                true,
+	"mail_queue_size":             true,
+}
+
+// reloadConfig re-reads the configuration and applies every setting that can
+// be hot-swapped, logging what changed. Settings in restartOnly keep their
+// current value. On error the running configuration is left untouched.
+func reloadConfig(args []string) {
+	next, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), args)
+	if err != nil {
+		log.Printf("config reload failed, keeping current settings: %v", err)
+		return
+	}
+	prev := conf()
+	pv, nv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+	changed := 0
+	for i := 0; i < pv.NumField(); i++ {
+		key, _, _ := strings.Cut(pv.Type().Field(i).Tag.Get("json"), ",")
+		if key == "" || reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		if restartOnly[key] {
+			log.Printf("config reload: %s changed but requires restart, ignored", key)
+			nv.Field(i).Set(pv.Field(i))
+			continue
+		}
+		log.Printf("config reload: %s changed", key)
+		changed++
+	}
+	current.Store(next)
+	applyLogLevel(next.LogLevel)
+	if prev.StrictTemplates != next.StrictTemplates || !reflect.DeepEqual(prev.TemplateDelims, next.TemplateDelims) ||
+		!reflect.DeepEqual(prev.DateFormats, next.DateFormats) || !reflect.DeepEqual(prev.PrintfFormats, next.PrintfFormats) {
+		resetTemplateCache() // parse options are baked into cached templates
+	}
+	log.Printf("config reloaded: %d settings applied", changed)
+}
+
+// applyLogLevel sets the minimum level for slog output.
+func applyLogLevel(level string) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err == nil {
+		slog.SetLogLoggerLevel(l)
+	}
+}
+
+// SitemapCacheTTL is how long a generated sitemap is served from memory.
+func (c *Config) SitemapCacheTTL() time.Duration {
+	return time.Duration(c.SitemapCacheTTLSec) * time.Second
+}
+
+// ShutdownTimeout is how long a graceful shutdown waits for requests.
+func (c *Config) ShutdownTimeout() time.Duration {
+	return time.Duration(c.ShutdownTimeoutSec) * time.Second
+}
+
+// MailBackoff is the wait after the first failed send attempt.
+func (c *Config) MailBackoff() time.Duration {
+	return time.Duration(c.MailBackoffMS) * time.Millisecond
+}
+
+// MailTimeout bounds sending one message, retries included.
+func (c *Config) MailTimeout() time.Duration {
+	return time.Duration(c.MailTimeoutSec) * time.Second
+}
+
+// ClusterPoll is how often the cluster signal file is checked.
+func (c *Config) ClusterPoll() time.Duration {
+	return time.Duration(c.ClusterPollSec) * time.Second
+}
+
+// ReadyTimeout is the deadline for the /readyz checks as a whole.
+func (c *Config) ReadyTimeout() time.Duration {
+	return time.Duration(c.ReadyTimeoutMS) * time.Millisecond
+}
+
+// SlowRender is the render duration above which a warning is logged.
+func (c *Config) SlowRender() time.Duration {
+	return time.Duration(c.SlowRenderMS) * time.Millisecond
+}
+
+// ContactMinInterval is the minimum time between contact submissions per IP.
+func (c *Config) ContactMinInterval() time.Duration {
+	return time.Duration(c.ContactMinIntervalSec) * time.Second
+}
+
+// loadConfig builds the configuration from defaults, the optional JSON file,
+// the environment and the flags in args, parsed with fs once the shared
+// flags are added to it. Commands define their own flags on fs beforehand
+// and read them, and any positional arguments, after loadConfig returns.
+func loadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file")
+	addr := fs.String("addr", "", "listen address, e.g. :9090")
+	baseURL := fs.String("base-url", "", "public origin of the site")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := defaultConfig()
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+	if *addr != "" {
+		c.Addr = *addr
+	}
+	if *baseURL != "" {
+		c.BaseURL = *baseURL
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile overlays settings from a JSON file, rejecting unknown keys.
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overlays settings from environment variables that are set.
+func (c *Config) loadEnv() error {
+	envString(&c.Addr, "ADDR")
+	envString(&c.BaseURL, "BASE_URL")
+	envString(&c.BasePath, "BASE_PATH")
+	envString(&c.BasicUser, "BASIC_USER")
+	envString(&c.BasicPass, "BASIC_PASS")
+	envString(&c.AdminUser, "ADMIN_USER")
+	envString(&c.AdminPass, "ADMIN_PASS")
+	envList(&c.APIKeys, "API_KEYS")
+	envList(&c.WarmupRoutes, "WARMUP_ROUTES")
+	envList(&c.TemplateDelims, "TEMPLATE_DELIMS")
+	envPathList(&c.ViewDirs, "VIEW_DIRS")
+	envList(&c.TrustedProxies, "TRUSTED_PROXIES")
+	envList(&c.AdminAllowCIDRs, "ADMIN_ALLOW_CIDRS")
+	envString(&c.Brand.Name, "BRAND_NAME")
+	envString(&c.Brand.Logo, "BRAND_LOGO")
+	envString(&c.Brand.PrimaryColor, "BRAND_PRIMARY_COLOR")
+	envString(&c.Brand.Favicon, "BRAND_FAVICON")
+	envString(&c.Brand.ShortName, "BRAND_SHORT_NAME")
+	envString(&c.SMTPAddr, "SMTP_ADDR")
+	envString(&c.SMTPUser, "SMTP_USER")
+	envString(&c.SMTPPass, "SMTP_PASS")
+	envString(&c.MailFrom, "MAIL_FROM")
+	envList(&c.MailTo, "MAIL_TO")
+	envString(&c.FailedMailDir, "FAILED_MAIL_DIR")
+	envString(&c.ProxyPrefix, "PROXY_PREFIX")
+	envString(&c.ProxyTarget, "PROXY_TARGET")
+	envString(&c.ProxyHealthPath, "PROXY_HEALTH_PATH")
+	envString(&c.ClusterSignal, "CLUSTER_SIGNAL")
+	envString(&c.ExportDir, "EXPORT_DIR")
+	envString(&c.CSP, "CSP")
+	envString(&c.CustomHeaders, "CUSTOM_HEADERS")
+	envString(&c.ServerHeader, "SERVER_HEADER")
+	envList(&c.Gone, "GONE")
+	envList(&c.AllowedMethods, "ALLOWED_METHODS")
+	envString(&c.LogLevel, "LOG_LEVEL")
+	envList(&c.LogFields, "LOG_FIELDS")
+	envList(&c.LogRedactQuery, "LOG_REDACT_QUERY")
+	envList(&c.LogRedactHeaders, "LOG_REDACT_HEADERS")
+	envList(&c.DebugRedactFields, "DEBUG_REDACT_FIELDS")
+	envString(&c.ImageCacheDir, "IMAGE_CACHE_DIR")
+	envString(&c.MaintenanceStart, "MAINTENANCE_START")
+	envString(&c.MaintenanceEnd, "MAINTENANCE_END")
+	envString(&c.CaptchaProvider, "CAPTCHA_PROVIDER")
+	envString(&c.CaptchaSiteKey, "CAPTCHA_SITE_KEY")
+	envString(&c.CaptchaSecret, "CAPTCHA_SECRET")
+	envString(&c.Env, "ENV")
+	envString(&c.DefaultLang, "DEFAULT_LANG")
+	envList(&c.RTLLangs, "RTL_LANGS")
+	envString(&c.DisplayTZ, "DISPLAY_TZ")
+	envString(&c.AnalyticsProvider, "ANALYTICS_PROVIDER")
+	envString(&c.AnalyticsSiteID, "ANALYTICS_SITE_ID")
+	if file := os.Getenv("CUSTOM_HEADERS_FILE"); file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("config: CUSTOM_HEADERS_FILE: %w", err)
+		}
+		c.CustomHeaders = string(b)
+	}
+	return errors.Join(
+		envMap(&c.AuthRules, "AUTH_RULES"),
+		envRedirects(&c.Redirects, "REDIRECTS"),
+		envInt(&c.WarmupWorkers, "WARMUP_WORKERS"),
+		envInt(&c.SlowRenderMS, "SLOW_RENDER_MS"),
+		envBool(&c.TemplateCache, "TEMPLATE_CACHE"),
+		envBool(&c.FallbackTemplates, "FALLBACK_TEMPLATES"),
+		envBool(&c.StrictTemplates, "STRICT_TEMPLATES"),
+		envBool(&c.RequireDirs, "REQUIRE_DIRS"),
+		envBool(&c.HSTS, "HSTS"),
+		envBool(&c.StartupGate, "STARTUP_GATE"),
+		envBool(&c.PWA, "PWA"),
+		envBool(&c.ServerTiming, "SERVER_TIMING"),
+		envBool(&c.RateLimitRefresh, "RATE_LIMIT_REFRESH"),
+		envBool(&c.DebugBodies, "DEBUG_BODIES"),
+		envInt(&c.DebugBodyMaxBytes, "DEBUG_BODY_MAX_BYTES"),
+		envInt(&c.HSTSMaxAgeSec, "HSTS_MAX_AGE_SEC"),
+		envBool(&c.HSTSIncludeSubdomains, "HSTS_INCLUDE_SUBDOMAINS"),
+		envBool(&c.HSTSPreload, "HSTS_PRELOAD"),
+		envBool(&c.Minify, "MINIFY"),
+		envInt(&c.ReadyTimeoutMS, "READY_TIMEOUT_MS"),
+		envInt(&c.MailAttempts, "MAIL_ATTEMPTS"),
+		envInt(&c.MailBackoffMS, "MAIL_BACKOFF_MS"),
+		envInt(&c.MailTimeoutSec, "MAIL_TIMEOUT_SEC"),
+		envInt(&c.MailQueueSize, "MAIL_QUEUE_SIZE"),
+		envBool(&c.Gzip, "GZIP"),
+		envInt(&c.GzipMinBytes, "GZIP_MIN_BYTES"),
+		envInt(&c.NotFoundSuggestions, "NOT_FOUND_SUGGESTIONS"),
+		envInt(&c.ShutdownTimeoutSec, "SHUTDOWN_TIMEOUT_SEC"),
+		envInt(&c.SitemapCacheTTLSec, "SITEMAP_CACHE_TTL_SEC"),
+		envFloat(&c.LogSampleRate, "LOG_SAMPLE_RATE"),
+		envBool(&c.ReadyCheckSMTP, "READY_CHECK_SMTP"),
+		envBool(&c.ReadyCheckProxy, "READY_CHECK_PROXY"),
+		envInt(&c.ClusterPollSec, "CLUSTER_POLL_SEC"),
+		envInt(&c.ProxyMaxIdleConns, "PROXY_MAX_IDLE_CONNS"),
+		envInt(&c.ProxyIdleConnTimeoutSec, "PROXY_IDLE_CONN_TIMEOUT_SEC"),
+		envInt(&c.ProxyDialTimeoutMS, "PROXY_DIAL_TIMEOUT_MS"),
+		envBool(&c.SitemapPing, "SITEMAP_PING"),
+		envBool(&c.Maintenance, "MAINTENANCE"),
+		envInt(&c.ContactMinIntervalSec, "CONTACT_MIN_INTERVAL_SEC"),
+		envInt(&c.ContactDailyCap, "CONTACT_DAILY_CAP"),
+		envFloat(&c.ContactRate, "CONTACT_RATE"),
+		envInt(&c.ContactBurst, "CONTACT_BURST"),
+		envInt64(&c.MaxDecompressedBytes, "MAX_DECOMPRESSED_BYTES"),
+		envInt(&c.MaxURLLen, "MAX_URL_LEN"),
+		envIntList(&c.ImageWidths, "IMAGE_WIDTHS"),
+		envBool(&c.WebP, "WEBP"),
+	)
+}
+
+// validate checks required fields and value ranges.
+func (c *Config) validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr is required"))
+	}
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("base_url %q must be an absolute URL", c.BaseURL))
+		}
+	} else if c.SitemapPing {
+		errs = append(errs, errors.New("base_url is required when sitemap_ping is enabled"))
+	}
+	for name, s := range c.SitemapSections {
+		switch s.ChangeFreq {
+		case "", "always", "hourly", "daily", "weekly", "monthly", "yearly", "never":
+		default:
+			errs = append(errs, fmt.Errorf("sitemap_sections.%s: invalid changefreq %q", name, s.ChangeFreq))
+		}
+		if s.Priority < 0 || s.Priority > 1 {
+			errs = append(errs, fmt.Errorf("sitemap_sections.%s: priority must be between 0 and 1", name))
+		}
+	}
+	for host, site := range c.Sites {
+		if (site.ViewDir == "" && len(site.ViewDirs) == 0) || site.PublicDir == "" {
+			errs = append(errs, fmt.Errorf("sites.%s: view_dir (or view_dirs) and public_dir are required", host))
+		}
+	}
+	if _, ok := c.Sites[c.DefaultHost]; c.DefaultHost != "" && !ok {
+		errs = append(errs, fmt.Errorf("default_host %q is not one of sites", c.DefaultHost))
+	}
+	if (c.MaintenanceStart == "") != (c.MaintenanceEnd == "") {
+		errs = append(errs, errors.New("maintenance_start and maintenance_end must be set together"))
+	} else if c.MaintenanceStart != "" {
+		start, serr := time.Parse(time.RFC3339, c.MaintenanceStart)
+		end, eerr := time.Parse(time.RFC3339, c.MaintenanceEnd)
+		switch {
+		case serr != nil || eerr != nil:
+			errs = append(errs, errors.New("maintenance_start and maintenance_end must be RFC 3339 times, e.g. 2026-01-02T03:00:00Z"))
+		case !end.After(start):
+			errs = append(errs, errors.New("maintenance_end must be after maintenance_start"))
+		}
+	}
+	if c.GzipMinBytes < 0 {
+		errs = append(errs, errors.New("gzip_min_bytes must not be negative"))
+	}
+	if len(c.AllowedMethods) == 0 {
+		errs = append(errs, errors.New("allowed_methods must not be empty"))
+	}
+	for i, m := range c.AllowedMethods {
+		c.AllowedMethods[i] = strings.ToUpper(m)
+		if !validHeaderName(m) {
+			errs = append(errs, fmt.Errorf("allowed_methods: %q is not a valid method", m))
+		}
+	}
+	if c.MaxURLLen < 0 {
+		errs = append(errs, errors.New("max_url_len must not be negative"))
+	}
+	if c.MaxDecompressedBytes < 1 {
+		errs = append(errs, errors.New("max_decompressed_bytes must be at least 1"))
+	}
+	if c.WarmupWorkers < 1 {
+		errs = append(errs, errors.New("warmup_workers must be at least 1"))
+	}
+	if len(c.TemplateDelims) != 2 || c.TemplateDelims[0] == "" || c.TemplateDelims[1] == "" {
+		errs = append(errs, errors.New(`template_delims must be a left and right delimiter, e.g. ["[[", "]]"]`))
+	}
+	for prefix, tier := range c.AuthRules {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, fmt.Errorf("auth_rules: prefix %q must start with /", prefix))
+		}
+		switch tier {
+		case authNone, authShared, authAdmin:
+		default:
+			errs = append(errs, fmt.Errorf("auth_rules.%s: tier %q must be none, shared or admin", prefix, tier))
+		}
+	}
+	if c.AdminUser != "" && c.AdminPass == "" {
+		errs = append(errs, errors.New("admin_pass is required when admin_user is set"))
+	}
+	if c.LogSampleRate < 0 || c.LogSampleRate > 1 {
+		errs = append(errs, errors.New("log_sample_rate must be between 0 and 1"))
+	}
+	for _, f := range c.LogFields {
+		if name, ok := strings.CutPrefix(f, "header:"); ok && validHeaderName(name) {
+			continue
+		}
+		if !slices.Contains(accessLogFields, f) {
+			errs = append(errs, fmt.Errorf("log_fields: unknown field %q", f))
+		}
+	}
+	if c.SitemapCacheTTLSec < 0 {
+		errs = append(errs, errors.New("sitemap_cache_ttl_sec must not be negative"))
+	}
+	if c.ShutdownTimeoutSec < 1 {
+		errs = append(errs, errors.New("shutdown_timeout_sec must be at least 1"))
+	}
+	if c.NotFoundSuggestions < 0 {
+		errs = append(errs, errors.New("not_found_suggestions must not be negative"))
+	}
+	if c.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			errs = append(errs, fmt.Errorf("smtp_addr %q must be host:port", c.SMTPAddr))
+		}
+		if c.MailFrom == "" || len(c.MailTo) == 0 {
+			errs = append(errs, errors.New("mail_from and mail_to are required when smtp_addr is set"))
+		}
+	}
+	if c.MailAttempts < 1 || c.MailBackoffMS < 0 || c.MailTimeoutSec < 1 || c.MailQueueSize < 1 {
+		errs = append(errs, errors.New("mail_attempts, mail_timeout_sec and mail_queue_size must be at least 1 and mail_backoff_ms not negative"))
+	}
+	if c.ReadyTimeoutMS < 1 {
+		errs = append(errs, errors.New("ready_timeout_ms must be at least 1"))
+	}
+	if c.ClusterPollSec < 1 {
+		errs = append(errs, errors.New("cluster_poll_sec must be at least 1"))
+	}
+	if c.ReadyCheckProxy && c.ProxyTarget == "" {
+		errs = append(errs, errors.New("ready_check_proxy requires proxy_target"))
+	}
+	if !strings.HasPrefix(c.ProxyHealthPath, "/") {
+		errs = append(errs, fmt.Errorf("proxy_health_path %q must start with /", c.ProxyHealthPath))
+	}
+	if c.ProxyMaxIdleConns < 0 || c.ProxyIdleConnTimeoutSec < 0 || c.ProxyDialTimeoutMS < 1 {
+		errs = append(errs, errors.New("proxy_max_idle_conns and proxy_idle_conn_timeout_sec must not be negative and proxy_dial_timeout_ms must be at least 1"))
+	}
+	if c.ReadyCheckSMTP && c.SMTPAddr == "" {
+		errs = append(errs, errors.New("smtp_addr is required when ready_check_smtp is enabled"))
+	}
+	if c.SlowRenderMS < 1 {
+		errs = append(errs, errors.New("slow_render_ms must be at least 1"))
+	}
+	if h, err := parseCustomHeaders(c.CustomHeaders); err != nil {
+		errs = append(errs, err)
+	} else {
+		c.headers = h
+	}
+	if !langTag.MatchString(c.DefaultLang) {
+		errs = append(errs, fmt.Errorf("default_lang %q must be a language tag such as en or pt-BR", c.DefaultLang))
+	}
+	for host, site := range c.Sites {
+		if site.Lang != "" && !langTag.MatchString(site.Lang) {
+			errs = append(errs, fmt.Errorf("sites.%s.lang %q must be a language tag such as en or pt-BR", host, site.Lang))
+		}
+	}
+	if c.Brand.Name == "" {
+		errs = append(errs, errors.New("brand.name is required"))
+	}
+	if !hexColor.MatchString(c.Brand.PrimaryColor) {
+		errs = append(errs, fmt.Errorf("brand.primary_color %q must be a hex color such as #ec1313", c.Brand.PrimaryColor))
+	}
+	for key, p := range map[string]string{"brand.logo": c.Brand.Logo, "brand.favicon": c.Brand.Favicon} {
+		if p != "" && !strings.HasPrefix(p, "/public/") {
+			errs = append(errs, fmt.Errorf("%s %q must be a path under /public/", key, p))
+		}
+	}
+	for _, icon := range c.Brand.Icons {
+		if !strings.HasPrefix(icon.Src, "/public/") || icon.Sizes == "" {
+			errs = append(errs, fmt.Errorf("brand.icons: %q must be a path under /public/ with sizes", icon.Src))
+		}
+	}
+	errs = append(errs, validateFormatFuncs(c)...)
+	errs = append(errs, validateRedirects(c.Redirects)...)
+	errs = append(errs, validateGone(c.Gone)...)
+	for name := range c.Features {
+		if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, ", ") {
+			errs = append(errs, fmt.Errorf("features: %q must not be empty, start with - or contain commas or spaces", name))
+		}
+	}
+	errs = append(errs, validateStaticMounts(c.StaticMounts)...)
+	if c.BasePath == "/" {
+		c.BasePath = ""
+	}
+	if c.BasePath != "" && (!strings.HasPrefix(c.BasePath, "/") || strings.HasSuffix(c.BasePath, "/")) {
+		errs = append(errs, fmt.Errorf("base_path %q must start with / and not end with one", c.BasePath))
+	}
+	if loc, err := time.LoadLocation(c.DisplayTZ); err != nil {
+		log.Printf("warning: display_tz %q: %v; using UTC", c.DisplayTZ, err)
+		c.location = time.UTC
+	} else {
+		c.location = loc
+	}
+	c.proxyTarget = nil
+	if c.ProxyTarget != "" {
+		if u, err := url.Parse(c.ProxyTarget); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("proxy_target %q must be an absolute URL", c.ProxyTarget))
+		} else {
+			c.proxyTarget = u
+		}
+		if !strings.HasPrefix(c.ProxyPrefix, "/") || strings.HasSuffix(c.ProxyPrefix, "/") {
+			errs = append(errs, fmt.Errorf("proxy_prefix %q must start with / and not end with one", c.ProxyPrefix))
+		}
+	}
+	proxies, perr := parsePrefixes("trusted_proxies", c.TrustedProxies)
+	adminNets, aerr := parsePrefixes("admin_allow_cidrs", c.AdminAllowCIDRs)
+	if perr != nil || aerr != nil {
+		errs = append(errs, errors.Join(perr, aerr))
+	}
+	c.proxies, c.adminNets = proxies, adminNets
+	if c.ContactMinIntervalSec < 0 {
+		errs = append(errs, errors.New("contact_min_interval_sec must not be negative"))
+	}
+	if c.ContactDailyCap < 1 {
+		errs = append(errs, errors.New("contact_daily_cap must be at least 1"))
+	}
+	if c.DebugBodyMaxBytes < 1 {
+		errs = append(errs, errors.New("debug_body_max_bytes must be at least 1"))
+	}
+	if c.HSTSMaxAgeSec < 0 {
+		errs = append(errs, errors.New("hsts_max_age_sec must not be negative"))
+	}
+	if c.HSTSPreload && (c.HSTSMaxAgeSec < 31536000 || !c.HSTSIncludeSubdomains) {
+		errs = append(errs, errors.New("hsts_preload requires hsts_include_subdomains and a hsts_max_age_sec of at least 31536000"))
+	}
+	if strings.ContainsAny(c.ServerHeader, "\r\n") {
+		errs = append(errs, errors.New("server_header must be a single line"))
+	}
+	if c.ContactRate < 0 || c.ContactBurst < 1 {
+		errs = append(errs, errors.New("contact_rate must not be negative and contact_burst must be at least 1"))
+	}
+	if _, ok := captchaProviders[c.CaptchaProvider]; !ok {
+		errs = append(errs, fmt.Errorf("captcha_provider %q must be hcaptcha or recaptcha", c.CaptchaProvider))
+	}
+	if _, ok := analyticsProviders[c.AnalyticsProvider]; !ok && c.AnalyticsProvider != "" {
+		errs = append(errs, fmt.Errorf("analytics_provider %q must be plausible or goatcounter", c.AnalyticsProvider))
+	}
+	if c.AnalyticsProvider != "" && c.AnalyticsSiteID == "" {
+		errs = append(errs, errors.New("analytics_site_id is required when analytics_provider is set"))
+	}
+	if c.CaptchaSecret != "" && c.CaptchaSiteKey == "" {
+		errs = append(errs, errors.New("captcha_site_key is required when captcha_secret is set"))
+	}
+	for _, width := range c.ImageWidths {
+		if width < 1 {
+			errs = append(errs, fmt.Errorf("image_widths: %d is not a positive width", width))
+		}
+	}
+	if (len(c.ImageWidths) > 0 || c.WebP) && c.ImageCacheDir == "" {
+		errs = append(errs, errors.New("image_cache_dir is required for image resizing and webp"))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log_level %q must be debug, info, warn or error", c.LogLevel))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// parsePrefixes parses a list of CIDRs from the setting named key.
+func parsePrefixes(key string, cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	var errs []error
+	for _, cidr := range cidrs {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, errors.Join(errs...)
+}
+
+func envString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+// envPathList reads a list separated like $PATH (":" on Unix).
+func envPathList(dst *[]string, key string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = filepath.SplitList(v)
+	}
+}
+
+func envList(dst *[]string, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+func envIntList(dst *[]int, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	var list []int
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", key, err)
+		}
+		list = append(list, n)
+	}
+	*dst = list
+	return nil
+}
+
+func envInt(dst *int, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = n
+	return nil
+}
+
+func envInt64(dst *int64, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = n
+	return nil
+}
+
+// envMap merges comma-separated key=value pairs into *dst.
+func envMap(dst *map[string]string, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	if *dst == nil {
+		*dst = map[string]string{}
+	}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		k, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("config: %s: %q is not key=value", key, item)
+		}
+		(*dst)[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	}
+	return nil
+}
+
+func envFloat(dst *float64, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = f
+	return nil
+}
+
+func envBool(dst *bool, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = b
+	return nil
+}
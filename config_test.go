@@ -0,0 +1,63 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// useConfig makes a validated copy of the default configuration, changed by
+// edit, the active one for the rest of the test.
+func useConfig(t *testing.T, edit func(c *Config)) *Config {
+	t.Helper()
+	c := defaultConfig()
+	if edit != nil {
+		edit(c)
+	}
+	if err := c.validate(); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	prev := current.Swap(c)
+	t.Cleanup(func() { current.Store(prev) })
+	return c
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("BASIC_USER", "editor")
+	t.Setenv("BASIC_PASS", "pw")
+	t.Setenv("API_KEYS", "k1, k2")
+	t.Setenv("EXPORT_DIR", "/tmp/out")
+	t.Setenv("SERVER_HEADER", "bv")
+	t.Setenv("DISPLAY_TZ", "Asia/Kolkata")
+	t.Setenv("GONE", "/old,/older")
+	t.Setenv("ALLOWED_METHODS", "GET,HEAD")
+	t.Setenv("RTL_LANGS", "ar")
+
+	c := defaultConfig()
+	if err := c.loadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ name, got, want string }{
+		{"BASIC_USER", c.BasicUser, "editor"},
+		{"BASIC_PASS", c.BasicPass, "pw"},
+		{"EXPORT_DIR", c.ExportDir, "/tmp/out"},
+		{"SERVER_HEADER", c.ServerHeader, "bv"},
+		{"DISPLAY_TZ", c.DisplayTZ, "Asia/Kolkata"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want []string
+	}{
+		{"API_KEYS", c.APIKeys, []string{"k1", "k2"}},
+		{"GONE", c.Gone, []string{"/old", "/older"}},
+		{"ALLOWED_METHODS", c.AllowedMethods, []string{"GET", "HEAD"}},
+		{"RTL_LANGS", c.RTLLangs, []string{"ar"}},
+	} {
+		if !slices.Equal(tt.got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
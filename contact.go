@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxContactBody caps the size of a contact form submission.
+const maxContactBody = 64 << 10
+
+// contactFields are the form fields echoed back to the page on error.
+var contactFields = []string{"name", "email", "subject", "message"}
+
+// contactHandler accepts contact form submissions. Submissions that fill in
+// the hidden "website" honeypot are treated as spam: the sender sees the
+// normal success page but nothing is delivered.
+func contactHandler(throttle *contactThrottle) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		limitBody(w, req, maxContactBody)
+		if err := req.ParseForm(); err != nil {
+			if bodyTooLarge(w, req, err) {
+				return
+			}
+			renderStatus(w, req, http.StatusBadRequest, "pages/contact_us.html", map[string]any{
+				"Error": "We couldn't read your message. Please try again.",
+			})
+			return
+		}
+
+		ip := clientIP(req)
+		if req.PostForm.Get("website") != "" {
+			slog.Debug("contact submission dropped", "reason", "honeypot", "ip", ip)
+			render(w, req, "pages/contact_us.html", map[string]any{"Sent": true})
+			return
+		}
+
+		values := map[string]string{}
+		for _, field := range contactFields {
+			values[field] = strings.TrimSpace(req.PostForm.Get(field))
+		}
+		if values["name"] == "" || values["message"] == "" {
+			renderStatus(w, req, http.StatusUnprocessableEntity, "pages/contact_us.html", map[string]any{
+				"Error":  "Please fill in your name and message.",
+				"Values": values,
+			})
+			return
+		}
+		if _, err := mail.ParseAddress(values["email"]); err != nil {
+			renderStatus(w, req, http.StatusUnprocessableEntity, "pages/contact_us.html", map[string]any{
+				"Error":  "Please enter a valid email address.",
+				"Values": values,
+			})
+			return
+		}
+
+		if reason, retry := throttle.allow(ip, time.Now()); reason != "" {
+			slog.Debug("contact submission dropped", "reason", reason, "ip", ip, "retry", retry)
+			writeRateLimited(w, req, retry, "/contact", values)
+			return
+		}
+
+		// The captcha is verified last: it is an outbound call, so the
+		// honeypot and throttle get to drop a flood before it is made
+		if ok, err := verifyCaptcha(req.Context(), req); !ok {
+			msg := "Please complete the captcha and try again."
+			status := http.StatusUnprocessableEntity
+			if err != nil {
+				slog.Warn("captcha verification failed", "err", err, "ip", ip)
+				msg = "We couldn't verify the captcha just now. Please try again in a moment."
+				status = http.StatusServiceUnavailable
+			}
+			renderStatus(w, req, status, "pages/contact_us.html", map[string]any{
+				"Error":  msg,
+				"Values": values,
+			})
+			return
+		}
+
+		if debugBuild && conf().DebugBodies {
+			slog.Debug("contact submission content",
+				"name", values["name"],
+				"email", values["email"],
+				"subject", values["subject"],
+				"message", values["message"],
+				"ip", ip,
+			)
+		}
+		outcome := "not mailed" // no smtp_addr
+		var err error
+		if conf().SMTPAddr != "" {
+			if m := contactMail(values, ip); mailOutbox != nil {
+				err, outcome = mailOutbox.enqueue(m), "queued"
+			} else {
+				ctx, cancel := context.WithTimeout(req.Context(), conf().MailTimeout())
+				err, outcome = sendMailWithRetry(ctx, m), "sent"
+				cancel()
+			}
+			if err != nil {
+				outcome = "failed"
+			}
+		}
+		// Only sizes at info level: the fields themselves are personal data
+		slog.Info("contact submission",
+			"ip", ip,
+			"name_len", len(values["name"]),
+			"email_len", len(values["email"]),
+			"subject_len", len(values["subject"]),
+			"message_len", len(values["message"]),
+			"outcome", outcome,
+		)
+		if err != nil {
+			slog.Warn("contact email not sent", "err", err, "ip", ip)
+			renderStatus(w, req, http.StatusServiceUnavailable, "pages/contact_us.html", map[string]any{
+				"Error":  "We couldn't send your message just now. Please try again later or email us directly.",
+				"Values": values,
+			})
+			return
+		}
+		render(w, req, "pages/contact_us.html", map[string]any{"Sent": true})
+	}
+}
+
+// contactThrottle enforces a minimum interval between submissions, an hourly
+// token bucket and a daily cap per client IP. Counters reset when the UTC
+// day changes.
+type contactThrottle struct {
+	mu   sync.Mutex
+	day  string
+	seen map[string]*submitter
+}
+
+type submitter struct {
+	last   time.Time
+	count  int
+	tokens float64 // bucket level as of last
+}
+
+func newContactThrottle() *contactThrottle {
+	return &contactThrottle{seen: map[string]*submitter{}}
+}
+
+// allow records a submission from ip at now, returning a non-empty reason
+// and how long until a submission would be accepted when it exceeds the
+// configured limits.
+func (t *contactThrottle) allow(ip string, now time.Time) (string, time.Duration) {
+	c := conf()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if day := now.UTC().Format(time.DateOnly); day != t.day {
+		t.day = day
+		t.seen = map[string]*submitter{}
+	}
+	s, ok := t.seen[ip]
+	if !ok {
+		s = &submitter{}
+		t.seen[ip] = s
+	}
+	if !s.last.IsZero() && now.Sub(s.last) < c.ContactMinInterval() {
+		return "too frequent", c.ContactMinInterval() - now.Sub(s.last)
+	}
+	if s.count >= c.ContactDailyCap {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return "daily cap", midnight.Sub(now)
+	}
+	tokens := float64(c.ContactBurst)
+	if !s.last.IsZero() {
+		tokens = min(tokens, s.tokens+now.Sub(s.last).Hours()*c.ContactRate)
+	}
+	if c.ContactRate > 0 && tokens < 1 {
+		return "hourly rate", time.Duration((1 - tokens) / c.ContactRate * float64(time.Hour))
+	}
+	s.last = now
+	s.count++
+	s.tokens = tokens - 1
+	return "", 0
+}
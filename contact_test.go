@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func contactPost(form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/contact", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestContactLogOmitsContent(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	form := url.Values{
+		"name":    {"Jane Roe"},
+		"email":   {"jane@example.com"},
+		"subject": {"Quote"},
+		"message": {"Please call me on 555-0100"},
+	}
+	rec := httptest.NewRecorder()
+	contactHandler(newContactThrottle()).ServeHTTP(rec, contactPost(form))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, `msg="contact submission"`) || !strings.Contains(logged, "message_len=26") ||
+		!strings.Contains(logged, `outcome="not mailed"`) {
+		t.Fatalf("no contact submission summary in log:\n%s", logged)
+	}
+	for _, v := range []string{"Jane Roe", "jane@example.com", "555-0100"} {
+		if strings.Contains(logged, v) {
+			t.Errorf("log contains %q:\n%s", v, logged)
+		}
+	}
+}
+
+func TestContactDebugBodiesLogsContent(t *testing.T) {
+	if !debugBuild {
+		t.Skip("debug_bodies needs -tags debug")
+	}
+	useConfig(t, func(c *Config) { c.DebugBodies = true })
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	form := url.Values{"name": {"Jane Roe"}, "email": {"jane@example.com"}, "message": {"hello"}}
+	contactHandler(newContactThrottle()).ServeHTTP(httptest.NewRecorder(), contactPost(form))
+	if logged := buf.String(); !strings.Contains(logged, `msg="contact submission content"`) || !strings.Contains(logged, "jane@example.com") {
+		t.Errorf("no contact submission content in debug log:\n%s", logged)
+	}
+}
+
+func TestContactThrottleKeepsValues(t *testing.T) {
+	useConfig(t, nil)
+	h := testHandler(t)
+	form := url.Values{"name": {"Jane"}, "email": {"jane@example.com"}, "message": {"First & second"}}
+
+	assertStatus(t, do(t, h, contactPost(form)), http.StatusOK)
+	resp := do(t, h, contactPost(form))
+	assertStatus(t, resp, http.StatusTooManyRequests)
+	assertContentType(t, resp, "text/html")
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	assertBodyContains(t, resp, `value="jane@example.com"`, ">First &amp; second</textarea>")
+	if strings.Contains(resp.Body, `http-equiv="refresh"`) {
+		t.Error("429 page with a kept form reloads itself")
+	}
+
+	req := contactPost(form)
+	req.Header.Set("Accept", "application/json")
+	resp = do(t, h, req)
+	assertStatus(t, resp, http.StatusTooManyRequests)
+	assertContentType(t, resp, "application/json")
+}
+
+func TestRateLimitedPageStrictTemplates(t *testing.T) {
+	useConfig(t, func(c *Config) { c.StrictTemplates = true })
+	resetTemplateCache()
+	t.Cleanup(resetTemplateCache)
+	h := testHandler(t)
+	form := url.Values{"name": {"Jane"}, "email": {"jane@example.com"}, "message": {"Hello"}}
+
+	assertStatus(t, do(t, h, newTestRequest(t, http.MethodGet, "/about-us", nil)), http.StatusOK)
+	assertStatus(t, do(t, h, contactPost(form)), http.StatusOK)
+	resp := do(t, h, contactPost(form))
+	assertStatus(t, resp, http.StatusTooManyRequests)
+	assertBodyContains(t, resp, ">Hello</textarea>")
+}
+
+func TestContactCaptchaAfterThrottle(t *testing.T) {
+	var verifies atomic.Int32
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		verifies.Add(1)
+		io.WriteString(w, `{"success": true}`)
+	}))
+	defer verifier.Close()
+	prev := captchaProviders["hcaptcha"]
+	p := prev
+	p.VerifyURL = verifier.URL
+	captchaProviders["hcaptcha"] = p
+	t.Cleanup(func() { captchaProviders["hcaptcha"] = prev })
+	useConfig(t, func(c *Config) { c.CaptchaSiteKey, c.CaptchaSecret = "site", "secret" })
+	h := contactHandler(newContactThrottle())
+
+	form := url.Values{"name": {"Jane"}, "email": {"jane@example.com"}, "message": {"Hello"}, p.Field: {"token"}}
+	bot := url.Values{"name": {"Bot"}, "email": {"bot@example.com"}, "message": {"Spam"}, "website": {"x"}, p.Field: {"token"}}
+	for _, tt := range []struct {
+		form     url.Values
+		status   int
+		verifies int32
+	}{
+		{bot, http.StatusOK, 0},               // honeypot
+		{form, http.StatusOK, 1},              // verified and accepted
+		{form, http.StatusTooManyRequests, 1}, // throttled before verifying
+		{bot, http.StatusOK, 1},               // honeypot, even while throttled
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, contactPost(tt.form))
+		if rec.Code != tt.status || verifies.Load() != tt.verifies {
+			t.Errorf("%s: status %d after %d verifications, want %d after %d",
+				tt.form.Get("name"), rec.Code, verifies.Load(), tt.status, tt.verifies)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+//go:build debug
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// debugBuild reports whether the binary was built with -tags debug, which
+// includes the /debug/ routes and body logging. See nodebug.go for the
+// production stubs.
+const debugBuild = true
+
+// registerDebugRoutes adds the /debug/ routes to admin: the route list of r
+// and the pprof profiles.
+func registerDebugRoutes(admin, r *mux.Router) {
+	admin.Handle("/debug/routes", routesHandler(r)).Methods(http.MethodGet).Name("debug-routes")
+	admin.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline).Name("debug-pprof-cmdline")
+	admin.HandleFunc("/debug/pprof/profile", pprof.Profile).Name("debug-pprof-profile")
+	admin.HandleFunc("/debug/pprof/symbol", pprof.Symbol).Name("debug-pprof-symbol")
+	admin.HandleFunc("/debug/pprof/trace", pprof.Trace).Name("debug-pprof-trace")
+	admin.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index).Name("debug-pprof")
+}
+
+// routeInfo describes one registered route.
+type routeInfo struct {
+	Path    string   `json:"path"`
+	Name    string   `json:"name,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// listRoutes walks r and returns its routes sorted by path template.
+func listRoutes(r *mux.Router) []routeInfo {
+	var routes []routeInfo
+	r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // e.g. host-only matchers
+		}
+		methods, _ := route.GetMethods()
+		routes = append(routes, routeInfo{Path: path, Name: route.GetName(), Methods: methods})
+		return nil
+	})
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	return routes
+}
+
+// routesHandler serves the routes registered on r as JSON.
+func routesHandler(r *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(listRoutes(r))
+	}
+}
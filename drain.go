@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// draining is set once the instance has been asked to drain before a
+// deploy. It is never cleared; the process is expected to be stopped.
+var draining atomic.Bool
+
+// errDraining is reported by the /readyz drain check.
+var errDraining = errors.New("draining")
+
+// startDrain puts the instance into drain mode: /readyz starts failing so
+// the load balancer stops sending new traffic, while requests keep being
+// served until SIGTERM shuts the server down gracefully. via names the
+// trigger for the log.
+func startDrain(via string) {
+	if !draining.CompareAndSwap(false, true) {
+		log.Printf("drain: already draining (requested via %s)", via)
+		return
+	}
+	log.Printf("drain: started via %s; /readyz now fails, send SIGTERM to shut down", via)
+}
+
+// drainConnections asks clients to close keep-alive connections while
+// draining so they reconnect to another instance.
+func drainConnections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if draining.Load() {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// connTracker counts the server's connections by state via http.Server's
+// ConnState hook, for the shutdown log.
+type connTracker struct {
+	mu    sync.Mutex
+	state map[net.Conn]http.ConnState
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{state: map[net.Conn]http.ConnState{}}
+}
+
+// track is the http.Server ConnState callback.
+func (t *connTracker) track(conn net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(t.state, conn)
+	default:
+		t.state[conn] = state
+	}
+}
+
+// counts returns the number of connections serving a request and the number
+// that are open but idle or not yet read from.
+func (t *connTracker) counts() (active, idle int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.state {
+		if s == http.StateActive {
+			active++
+		} else {
+			idle++
+		}
+	}
+	return active, idle
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// exportReport lists what one export run wrote and which routes failed.
+type exportReport struct {
+	Dir      string   `json:"dir"`
+	Exported []string `json:"exported"`
+	Failed   []string `json:"failed"`
+}
+
+// exportCmd renders the site to static files in conf().ExportDir, or in the
+// directory given as -dir or as the only argument.
+func exportCmd(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory, overriding export_dir")
+	c, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case flags.NArg() > 1 || flags.NArg() == 1 && *dir != "":
+		return errors.New("usage: bitvistara export [flags] [-dir DIR | DIR]")
+	case flags.NArg() == 1:
+		c.ExportDir = flags.Arg(0)
+	case *dir != "":
+		c.ExportDir = *dir
+	}
+	current.Store(c)
+	if c.ExportDir == "" {
+		return errors.New("export: no output directory; pass -dir or set export_dir (EXPORT_DIR)")
+	}
+	report, err := exportSites(newHandler(), c.ExportDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("exported %d files to %s (%d failed)\n", len(report.Exported), report.Dir, len(report.Failed))
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("export: failed routes: %s", strings.Join(report.Failed, ", "))
+	}
+	return nil
+}
+
+// exportSites renders every site through h into dir, one subdirectory per
+// host when serving multiple sites.
+func exportSites(h http.Handler, dir string) (exportReport, error) {
+	c := conf()
+	if len(c.Sites) == 0 {
+		return exportSite(h, sitesOf(c)[""], "", dir)
+	}
+	hosts := make([]string, 0, len(c.Sites))
+	for host := range c.Sites {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	total := exportReport{Dir: dir, Exported: []string{}, Failed: []string{}}
+	for _, host := range hosts {
+		report, err := exportSite(h, c.Sites[host], normalizeHost(host), filepath.Join(dir, normalizeHost(host)))
+		if err != nil {
+			return total, err
+		}
+		total.Exported = append(total.Exported, report.Exported...)
+		total.Failed = append(total.Failed, report.Failed...)
+	}
+	return total, nil
+}
+
+// exportRoutes returns the paths rendered by an export: every static page,
+// the sitemaps, and a path that is never routed so the 404 page is saved.
+func exportRoutes() []string {
+	routes := make([]string, 0, len(pages)+3)
+	for _, p := range pages {
+		routes = append(routes, p.Path)
+	}
+	return append(routes, "/sitemap.xml", "/sitemap.txt", "/404.html")
+}
+
+// exportSite renders site's routes through h as host and writes them under
+// dir ("/about-us" becomes about-us/index.html), then copies the public
+// directory and any static mounts under their URL prefixes.
+func exportSite(h http.Handler, site Site, host, dir string) (exportReport, error) {
+	report := exportReport{Dir: dir, Exported: []string{}, Failed: []string{}}
+	for _, route := range exportRoutes() {
+		req := httptest.NewRequest(http.MethodGet, route, nil)
+		if host != "" {
+			req.Host = host
+		}
+		req.SetBasicAuth(conf().BasicUser, conf().BasicPass)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		want := http.StatusOK
+		if route == "/404.html" {
+			want = http.StatusNotFound
+		}
+		if rec.Code != want {
+			log.Printf("export: %s%s returned %d", host, route, rec.Code)
+			report.Failed = append(report.Failed, host+route)
+			continue
+		}
+		name := exportFile(route)
+		if err := writeExportFile(filepath.Join(dir, name), rec.Body.Bytes()); err != nil {
+			return report, fmt.Errorf("export: %w", err)
+		}
+		report.Exported = append(report.Exported, filepath.Join(dir, name))
+	}
+
+	n := 0
+	for _, m := range staticMounts(conf(), site) {
+		copied, err := copyDir(m.Dir, filepath.Join(dir, filepath.FromSlash(strings.Trim(m.Prefix, "/"))))
+		if err != nil {
+			return report, fmt.Errorf("export: copying %s: %w", m.Dir, err)
+		}
+		n += copied
+	}
+	// .well-known is also served from the site root
+	wellKnown := filepath.Join(site.PublicDir, ".well-known")
+	if _, err := os.Stat(wellKnown); err == nil {
+		if _, err := copyDir(wellKnown, filepath.Join(dir, ".well-known")); err != nil {
+			return report, fmt.Errorf("export: copying %s: %w", wellKnown, err)
+		}
+	}
+	log.Printf("export: wrote %d pages and %d static files to %s (%d failed)", len(report.Exported), n, dir, len(report.Failed))
+	return report, nil
+}
+
+// exportFile maps a route to its file path relative to the export root.
+func exportFile(route string) string {
+	switch {
+	case route == "/":
+		return "index.html"
+	case filepath.Ext(route) != "":
+		return filepath.FromSlash(strings.TrimPrefix(route, "/"))
+	default:
+		return filepath.Join(filepath.FromSlash(strings.Trim(route, "/")), "index.html")
+	}
+}
+
+func writeExportFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// copyDir copies the regular files under src to dst and returns how many it
+// copied.
+func copyDir(src, dst string) (int, error) {
+	n := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		target := filepath.Join(dst, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		n++
+		return out.Close()
+	})
+	return n, err
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportCmdDir(t *testing.T) {
+	useConfig(t, nil) // exportCmd stores its own; restored on cleanup
+	t.Setenv("EXPORT_DIR", "")
+
+	for _, args := range [][]string{{"-dir", "DIR"}, {"DIR"}} {
+		dir := filepath.Join(t.TempDir(), "out")
+		for i, a := range args {
+			if a == "DIR" {
+				args[i] = dir
+			}
+		}
+		if err := exportCmd(args); err != nil {
+			t.Fatalf("export %q: %v", args, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "about-us", "index.html")); err != nil {
+			t.Errorf("export %q: %v", args, err)
+		}
+	}
+
+	for _, args := range [][]string{nil, {"a", "b"}, {"-dir", "a", "b"}} {
+		if err := exportCmd(args); err == nil {
+			t.Errorf("export %q: no error", args)
+		}
+	}
+}
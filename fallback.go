@@ -0,0 +1,138 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fallbackFS holds a minimal built-in template set used when templates under
+// view/ are missing, so a broken deployment still serves something sensible.
+//
+//go:embed fallback/*.html
+var fallbackFS embed.FS
+
+// fallbackTemplates maps page names (page.html, error.html, 404.html,
+// 500.html) to their parsed templates, each combined with the built-in base
+// layout.
+var fallbackTemplates = func() map[string]*template.Template {
+	m := map[string]*template.Template{}
+	for _, name := range []string{"page.html", "error.html", "404.html", "500.html"} {
+		m[name] = template.Must(template.New("base.html").Funcs(template.FuncMap{"url": sitePath}).ParseFS(fallbackFS, "fallback/base.html", "fallback/"+name))
+	}
+	return m
+}()
+
+// fallbackData is passed to built-in templates.
+type fallbackData struct {
+	Fallback bool // show the "using fallback template" banner
+	Status   int
+	Message  string   // shown by error.html
+	Suggest  []string // similar paths, shown by 404.html
+	Data     any
+}
+
+// renderFallback renders the built-in stand-in for a missing template.
+func renderFallback(w http.ResponseWriter, status int, filename string, data any) {
+	name := "page.html"
+	if _, ok := fallbackTemplates[path.Base(filename)]; ok {
+		name = path.Base(filename)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := fallbackTemplates[name].ExecuteTemplate(w, "base", fallbackData{Fallback: true, Status: status, Data: data}); err != nil {
+		log.Printf("fallback template execute error for %s: %v", name, err)
+	}
+}
+
+// writeError reports an error to the client in the form it asked for: a
+// JSON body of {"error": msg, "status": status} for requests under /api/ or
+// that accept application/json, and the HTML error page otherwise. An empty
+// msg defaults to the status text.
+func writeError(w http.ResponseWriter, req *http.Request, status int, msg string) {
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	if !wantsJSON(req) {
+		renderError(w, status, msg)
+		return
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": msg, "status": status})
+}
+
+// writeRateLimited answers a rate-limited request with a 429 and a
+// Retry-After of retry: the JSON error for API clients, and for browsers
+// pages/rate-limited.html, which reloads back to next once retry has passed
+// when conf().RateLimitRefresh is set. A rejected form post passes its
+// fields as values; the page then offers them again in a form posting to
+// next instead of reloading, which would throw them away.
+func writeRateLimited(w http.ResponseWriter, req *http.Request, retry time.Duration, next string, values map[string]string) {
+	secs := int(math.Ceil(retry.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	if wantsJSON(req) {
+		writeError(w, req, http.StatusTooManyRequests, fmt.Sprintf("Too many requests; retry in %d seconds.", secs))
+		return
+	}
+	data := map[string]any{"RetryAfter": secs, "Retry": retry.Round(time.Second).String(), "Next": sitePath(next)}
+	if len(values) > 0 {
+		data["Values"] = values
+	} else if conf().RateLimitRefresh {
+		data["Refresh"] = fmt.Sprintf("%d; url=%s", secs, sitePath(next))
+	}
+	renderStatus(w, req, http.StatusTooManyRequests, "pages/rate-limited.html", data)
+}
+
+// wantsJSON reports whether req is an API call or prefers a JSON response.
+func wantsJSON(req *http.Request) bool {
+	if strings.HasPrefix(req.URL.Path, "/api/") {
+		return true
+	}
+	for _, v := range strings.Split(req.Header.Get("Accept"), ",") {
+		mt, _, _ := strings.Cut(v, ";")
+		if strings.EqualFold(strings.TrimSpace(mt), "application/json") {
+			return true
+		}
+	}
+	return false
+}
+
+// renderError writes the built-in error page for status, or msg as plain
+// text when fallback templates are disabled. Handlers should go through
+// writeError so API clients get JSON instead.
+func renderError(w http.ResponseWriter, status int, msg string) {
+	if !conf().FallbackTemplates {
+		http.Error(w, msg, status)
+		return
+	}
+	renderErrorPage(w, fallbackData{Status: status, Message: msg})
+}
+
+// renderErrorPage writes the built-in error page for data.Status.
+func renderErrorPage(w http.ResponseWriter, data fallbackData) {
+	name := "error.html"
+	switch {
+	case data.Status == http.StatusNotFound:
+		name = "404.html"
+	case data.Status >= http.StatusInternalServerError:
+		name = "500.html"
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(data.Status)
+	if err := fallbackTemplates[name].ExecuteTemplate(w, "base", data); err != nil {
+		log.Printf("error template execute error for %s: %v", name, err)
+	}
+}
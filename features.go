@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// featuresKey is the request context key for per-request feature flag
+// overrides.
+type featuresKey struct{}
+
+// featureEnabled reports whether the boolean feature flag name is on for the
+// request ctx belongs to: its override when one was set, otherwise
+// conf().Features. Unknown flags are off.
+func featureEnabled(ctx context.Context, name string) bool {
+	if flags, ok := ctx.Value(featuresKey{}).(map[string]bool); ok {
+		return flags[name]
+	}
+	return conf().Features[name]
+}
+
+// features lets authenticated users override conf().Features for their own
+// requests, to try dark features before turning them on for everyone. The
+// overrides are read from the "features" cookie, then the X-Features header,
+// then the ?features= query parameter, each a comma-separated list where
+// "name" turns a flag on and "-name" off; later sources win. Only flags
+// declared in the config can be overridden, and overridden responses are
+// marked uncacheable.
+func features(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c := conf()
+		var specs []string
+		if cookie, err := req.Cookie("features"); err == nil {
+			specs = append(specs, cookie.Value)
+		}
+		specs = append(specs, req.Header.Get("X-Features"), req.URL.Query().Get("features"))
+		if strings.Join(specs, "") == "" || !featureTrusted(c, req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		flags := maps.Clone(c.Features)
+		for _, spec := range specs {
+			for _, name := range strings.Split(spec, ",") {
+				name = strings.TrimSpace(name)
+				name, off := strings.CutPrefix(name, "-")
+				if _, ok := flags[name]; ok {
+					flags[name] = !off
+				}
+			}
+		}
+		slog.Debug("feature overrides", "path", req.URL.Path, "flags", flags)
+		w.Header().Set("Cache-Control", "private, no-store")
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), featuresKey{}, flags)))
+	})
+}
+
+// featureTrusted reports whether req may override feature flags: it passed
+// authorize, or it carries the admin or shared basic auth credentials on a
+// public path, where authorize does not check them.
+func featureTrusted(c *Config, req *http.Request) bool {
+	if authUser(req) != "" {
+		return true
+	}
+	user, pass, ok := req.BasicAuth()
+	if !ok || user == "" {
+		return false
+	}
+	return c.AdminUser != "" && secureEqual(user, c.AdminUser) && secureEqual(pass, c.AdminPass) ||
+		c.BasicUser != "" && secureEqual(user, c.BasicUser) && secureEqual(pass, c.BasicPass)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestFeatureOverridesNeedAuth(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.Features = map[string]bool{"new-nav": false, "banner": true}
+	})
+	h := features(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "new-nav=%t banner=%t", featureEnabled(req.Context(), "new-nav"), featureEnabled(req.Context(), "banner"))
+	}))
+	defaults := "new-nav=false banner=true"
+	overridden := "new-nav=true banner=false"
+
+	for _, tt := range []struct {
+		name       string
+		user, pass string
+		want       string
+	}{
+		{"anonymous", "", "", defaults},
+		{"wrong password", "admin", "wrong", defaults},
+		{"shared credentials", "admin", "0987654321", overridden},
+	} {
+		for _, source := range []string{"query", "header", "cookie"} {
+			req := newTestRequest(t, http.MethodGet, "/", nil)
+			switch source {
+			case "query":
+				req = newTestRequest(t, http.MethodGet, "/?features=new-nav,-banner", nil)
+			case "header":
+				req.Header.Set("X-Features", "new-nav,-banner")
+			case "cookie":
+				req.AddCookie(&http.Cookie{Name: "features", Value: "new-nav,-banner"})
+			}
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			resp := do(t, h, req)
+			if resp.Body != tt.want {
+				t.Errorf("%s via %s: %q, want %q", tt.name, source, resp.Body, tt.want)
+			}
+			if cc := resp.Header.Get("Cache-Control"); (tt.want == overridden) != (cc == "private, no-store") {
+				t.Errorf("%s via %s: Cache-Control %q", tt.name, source, cc)
+			}
+		}
+	}
+}
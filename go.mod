@@ -1,5 +1,12 @@
 module bitVistara
 
-go 1.22.0
+go 1.22.2
 
-require github.com/gorilla/mux v1.8.1
+require (
+	github.com/HugoSmits86/nativewebp v1.3.0
+	github.com/gorilla/mux v1.8.1
+	github.com/tdewolff/minify/v2 v2.21.3
+	golang.org/x/image v0.24.0
+)
+
+require github.com/tdewolff/parse/v2 v2.7.19 // indirect
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// gzipResponse compresses responses for clients that accept gzip. Output is
+// buffered until conf().GzipMinBytes have been written: smaller responses
+// are sent as they are, since compression would only add overhead. Range
+// requests, already-encoded bodies and non-text content types pass through.
+func gzipResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c := conf()
+		if !c.Gzip || !acceptsGzip(req) || req.Header.Get("Range") != "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipWriter{ResponseWriter: w, min: c.GzipMinBytes}
+		defer gw.close()
+		next.ServeHTTP(gw, req)
+	})
+}
+
+// acceptsGzip reports whether req's Accept-Encoding allows gzip.
+func acceptsGzip(req *http.Request) bool {
+	for _, v := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+		if !strings.EqualFold(strings.TrimSpace(enc), "gzip") {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// compressible reports whether a response of contentType is worth gzipping.
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mt, "text/") {
+		return true
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript", "application/ld+json", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// gzipWriter holds back the response until it knows whether to compress:
+// once min bytes are buffered, or when the handler finishes or flushes.
+type gzipWriter struct {
+	http.ResponseWriter
+	min     int
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer // nil when passing through
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+	if g.decided || g.status != 0 {
+		if g.decided {
+			g.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	g.status = code
+	// Bodiless and informational responses go straight out
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		g.decide(false)
+	}
+}
+
+func (g *gzipWriter) Write(b []byte) (int, error) {
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(b)
+		}
+		return g.ResponseWriter.Write(b)
+	}
+	g.buf = append(g.buf, b...)
+	if len(g.buf) >= g.min {
+		if err := g.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends what is buffered, compressing it if it already reaches min.
+func (g *gzipWriter) Flush() {
+	if !g.decided {
+		g.decide(len(g.buf) >= g.min)
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+func (g *gzipWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// decide writes the header and the buffered bytes, engaging the compressor
+// when compress is set and the response is eligible.
+func (g *gzipWriter) decide(compress bool) error {
+	g.decided = true
+	h := g.ResponseWriter.Header()
+	if h.Get("Content-Type") == "" && len(g.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+	if compress && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	buf := g.buf
+	g.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(buf)
+	} else {
+		_, err = g.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends a response that never reached min uncompressed and finishes
+// the gzip stream otherwise.
+func (g *gzipWriter) close() {
+	if !g.decided {
+		if g.status == 0 && len(g.buf) == 0 {
+			return // nothing written; let net/http send its default 200
+		}
+		g.decide(false)
+	}
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
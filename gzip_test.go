@@ -0,0 +1,73 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipResponseMinBytes(t *testing.T) {
+	useConfig(t, func(c *Config) { c.GzipMinBytes = 100 })
+
+	for _, tt := range []struct {
+		size int
+		gzip bool
+	}{
+		{0, false},
+		{99, false},
+		{100, true},
+		{5000, true},
+	} {
+		body := strings.Repeat("x", tt.size)
+		h := gzipResponse(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, body)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		got := rec.Body.String()
+		if encoded := rec.Header().Get("Content-Encoding") == "gzip"; encoded != tt.gzip {
+			t.Errorf("%d bytes: gzipped %t, want %t", tt.size, encoded, tt.gzip)
+			continue
+		} else if encoded {
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("%d bytes: %v", tt.size, err)
+			}
+			b, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("%d bytes: %v", tt.size, err)
+			}
+			got = string(b)
+		}
+		if got != body {
+			t.Errorf("%d bytes: body of %d bytes differs", tt.size, len(got))
+		}
+		if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%d bytes: Vary %q", tt.size, vary)
+		}
+	}
+}
+
+func TestGzipResponseNotAccepted(t *testing.T) {
+	useConfig(t, func(c *Config) { c.GzipMinBytes = 100 })
+	h := gzipResponse(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, strings.Repeat("x", 5000))
+	}))
+	for _, ae := range []string{"", "br", "gzip;q=0"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", ae)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q", ae, ce)
+		}
+	}
+}
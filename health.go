@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// readyCheck is one subsystem verified by /readyz.
+type readyCheck struct {
+	name    string
+	enabled func(c *Config) bool
+	run     func(ctx context.Context, c *Config) error
+}
+
+// initialized is set by serve once the startup warm-up has finished; until
+// then the startup check fails and startupGate may hold traffic back.
+var initialized atomic.Bool
+
+// errStarting is reported by the /readyz startup check.
+var errStarting = errors.New("warming up")
+
+// readyChecks lists every readiness check; disabled ones are skipped and
+// left out of the response.
+var readyChecks = []readyCheck{
+	{
+		name:    "startup",
+		enabled: func(*Config) bool { return true },
+		run: func(context.Context, *Config) error {
+			if !initialized.Load() {
+				return errStarting
+			}
+			return nil
+		},
+	},
+	{
+		name:    "drain",
+		enabled: func(*Config) bool { return true },
+		run: func(context.Context, *Config) error {
+			if draining.Load() {
+				return errDraining
+			}
+			return nil
+		},
+	},
+	{
+		name:    "views",
+		enabled: func(*Config) bool { return true },
+		run: func(_ context.Context, c *Config) error {
+			for _, site := range sitesOf(c) {
+				if p, ok := site.viewPath("layout/base.html"); !ok {
+					return fmt.Errorf("%s: not found", p)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name:    "upstream",
+		enabled: func(c *Config) bool { return c.ReadyCheckProxy && c.proxyTarget != nil },
+		run:     checkUpstream,
+	},
+	{
+		name:    "smtp",
+		enabled: func(c *Config) bool { return c.ReadyCheckSMTP && c.SMTPAddr != "" },
+		run: func(ctx context.Context, c *Config) error {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", c.SMTPAddr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	},
+}
+
+// checkResult is the JSON form of one check's outcome.
+type checkResult struct {
+	Status string `json:"status"` // "ok" or "error"
+	Error  string `json:"error,omitempty"`
+}
+
+// healthzHandler reports that the process is up. It checks nothing else so
+// a struggling dependency never gets the server restarted.
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
+
+// ping answers GET and HEAD /ping with "pong" before any other middleware
+// runs: no auth, logging, maintenance page or site dispatch, so it stays
+// the cheapest possible liveness signal for uptime monitors.
+func ping(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/ping" || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("pong\n"))
+	})
+}
+
+// startupGate answers every request except the health probes with a 503
+// and Retry-After until the startup warm-up has finished, when
+// conf().StartupGate is set. It wraps the server handler, outside the
+// router, so the warm-up itself is not held back.
+func startupGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if initialized.Load() || !conf().StartupGate {
+			next.ServeHTTP(w, req)
+			return
+		}
+		switch req.URL.Path {
+		case "/healthz", "/readyz":
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Cache-Control", "no-store")
+		writeError(w, req, http.StatusServiceUnavailable, "The server is starting up. Please retry in a moment.")
+	})
+}
+
+// readyzHandler runs the enabled readiness checks concurrently within
+// conf().ReadyTimeout and answers 200 when all pass, 503 otherwise, with
+// each check's result in the body.
+func readyzHandler(w http.ResponseWriter, req *http.Request) {
+	c := conf()
+	ctx, cancel := context.WithTimeout(req.Context(), c.ReadyTimeout())
+	defer cancel()
+
+	results := map[string]checkResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range readyChecks {
+		if !check.enabled(c) {
+			continue
+		}
+		wg.Add(1)
+		go func(check readyCheck) {
+			defer wg.Done()
+			done := make(chan error, 1)
+			go func() { done <- check.run(ctx, c) }()
+			var err error
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				err = fmt.Errorf("timed out: %w", ctx.Err())
+			}
+			res := checkResult{Status: "ok"}
+			if err != nil {
+				res = checkResult{Status: "error", Error: err.Error()}
+			}
+			mu.Lock()
+			results[check.name] = res
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, res := range results {
+		if res.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": results})
+}
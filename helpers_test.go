@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testHandler returns the handler serve installs on its http.Server, built
+// from the active configuration.
+func testHandler(t *testing.T) http.Handler {
+	t.Helper()
+	return drainConnections(serverOptions(stripBasePath(ping(startupGate(newHandler())))))
+}
+
+// newTestRequest builds a request for target: a path, to be sent with
+// ServeHTTP, or an absolute URL on an httptest.Server.
+func newTestRequest(t *testing.T, method, target string, body io.Reader) *http.Request {
+	t.Helper()
+	if strings.HasPrefix(target, "/") || target == "*" {
+		return httptest.NewRequest(method, target, body)
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// authRequest is newTestRequest with HTTP Basic credentials.
+func authRequest(t *testing.T, method, target, user, pass string) *http.Request {
+	t.Helper()
+	req := newTestRequest(t, method, target, nil)
+	req.SetBasicAuth(user, pass)
+	return req
+}
+
+// testResponse is a response with its body already read.
+type testResponse struct {
+	*http.Response
+	Body string
+}
+
+// do sends req to h through ServeHTTP, or over the network with
+// http.DefaultClient when h is nil (for requests built against an
+// httptest.Server URL).
+func do(t *testing.T, h http.Handler, req *http.Request) *testResponse {
+	t.Helper()
+	var resp *http.Response
+	if h != nil {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		resp = rec.Result()
+		resp.Request = req
+	} else {
+		var err error
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testResponse{Response: resp, Body: string(b)}
+}
+
+// assertStatus fails the test unless resp has the status code want.
+func assertStatus(t *testing.T, resp *testResponse, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s: status %d, want %d", resp.Request.Method, resp.Request.URL, resp.StatusCode, want)
+	}
+}
+
+// assertContentType fails the test unless resp's media type, ignoring
+// parameters such as charset, is want.
+func assertContentType(t *testing.T, resp *testResponse, want string) {
+	t.Helper()
+	got, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if got != want {
+		t.Fatalf("%s %s: Content-Type %q, want %s", resp.Request.Method, resp.Request.URL, resp.Header.Get("Content-Type"), want)
+	}
+}
+
+// assertBodyContains fails the test unless resp's body contains every one
+// of subs.
+func assertBodyContains(t *testing.T, resp *testResponse, subs ...string) {
+	t.Helper()
+	for _, s := range subs {
+		if !strings.Contains(resp.Body, s) {
+			t.Fatalf("%s %s: body does not contain %q", resp.Request.Method, resp.Request.URL, s)
+		}
+	}
+}
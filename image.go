@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// staticHandler serves files from dir. JPEG and PNG images are resized on
+// the fly when the request carries a ?w= width from conf().ImageWidths, and
+// converted to WebP for browsers that accept it when conf().WebP is set.
+// Files served as-is carry a content-hash ETag from the asset manifest
+// (see assetETag), stable across deploys that don't change them. Missing
+// files get the site's 404 page rather than the file server's
+// plain-text one.
+func staticHandler(dir string) http.Handler {
+	fileServer := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+req.URL.Path)))
+		info, err := os.Stat(name)
+		if err != nil {
+			writeError(w, req, http.StatusNotFound, "")
+			return
+		}
+		if !resizable(req.URL.Path) {
+			if !info.IsDir() {
+				w.Header().Set("ETag", assetETag(name, info))
+			}
+			fileServer.ServeHTTP(w, req)
+			return
+		}
+		width := 0
+		if req.URL.Query().Has("w") {
+			n, err := strconv.Atoi(req.URL.Query().Get("w"))
+			if err != nil || !slices.Contains(conf().ImageWidths, n) {
+				writeError(w, req, http.StatusBadRequest, "unsupported image width")
+				return
+			}
+			width = n
+		}
+		webp := false
+		if conf().WebP {
+			w.Header().Add("Vary", "Accept")
+			webp = strings.Contains(req.Header.Get("Accept"), "image/webp")
+		}
+		if width == 0 && !webp {
+			w.Header().Set("ETag", assetETag(name, info))
+			fileServer.ServeHTTP(w, req)
+			return
+		}
+		serveVariant(w, req, dir, width, webp, fileServer)
+	})
+}
+
+// resizable reports whether name is an image format we can re-encode.
+func resizable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// serveVariant serves the image at req.URL.Path scaled to width (0 keeps the
+// original size) and optionally re-encoded as WebP, generating and caching
+// the derived file on first use. The original is served whenever a variant
+// would not help: the image is already narrower than width, or the WebP
+// encoding came out larger than the source.
+func serveVariant(w http.ResponseWriter, req *http.Request, dir string, width int, webp bool, original http.Handler) {
+	src := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+req.URL.Path)))
+	info, err := os.Stat(src)
+	if err != nil || info.IsDir() {
+		original.ServeHTTP(w, req)
+		return
+	}
+
+	ext := strings.ToLower(path.Ext(src))
+	if webp {
+		ext = ".webp"
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", src, width)))
+	cached := filepath.Join(conf().ImageCacheDir, hex.EncodeToString(sum[:16])+ext)
+	ci, err := os.Stat(cached)
+	if err != nil || ci.ModTime().Before(info.ModTime()) {
+		// Encoding is the expensive part; skip it if the client has gone
+		if req.Context().Err() != nil {
+			return
+		}
+		ok, err := deriveImage(src, cached, width, webp)
+		if err != nil {
+			log.Printf("image variant %s (w=%d webp=%t): %v", src, width, webp, err)
+		}
+		if !ok {
+			original.ServeHTTP(w, req)
+			return
+		}
+		if ci, err = os.Stat(cached); err != nil {
+			original.ServeHTTP(w, req)
+			return
+		}
+	}
+	if webp && width == 0 && ci.Size() >= info.Size() {
+		original.ServeHTTP(w, req)
+		return
+	}
+
+	f, err := os.Open(cached)
+	if err != nil {
+		original.ServeHTTP(w, req)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, req, cached, info.ModTime(), f)
+}
+
+// deriveImage decodes src, scales it to width when that shrinks it and
+// writes it to dst as WebP or in its original format. It returns false when
+// the original should be served instead (decode failure or nothing to do).
+func deriveImage(src, dst string, width int, webp bool) (bool, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	img, format, err := image.Decode(in)
+	if err != nil {
+		return false, err
+	}
+	if b := img.Bounds(); width > 0 && b.Dx() > width {
+		height := b.Dy() * width / b.Dx()
+		scaled := image.NewRGBA(image.Rect(0, 0, width, max(height, 1)))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, b, draw.Over, nil)
+		img = scaled
+	} else if !webp {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return false, err
+	}
+	// Write to a temp file and rename so concurrent requests never see a
+	// partially written image.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".variant-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	switch {
+	case webp:
+		err = nativewebp.Encode(tmp, img, nil)
+	case format == "png":
+		err = png.Encode(tmp, img)
+	default:
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: 85})
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// mailMessage is an outgoing plain-text email. It is also the JSON format of
+// messages saved to conf().FailedMailDir.
+type mailMessage struct {
+	From    string    `json:"from"`
+	To      []string  `json:"to"`
+	ReplyTo string    `json:"reply_to,omitempty"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Date    time.Time `json:"date"`
+}
+
+// bytes renders m as an RFC 5322 message with CRLF line endings.
+func (m mailMessage) bytes() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	if m.ReplyTo != "" {
+		fmt.Fprintf(&b, "Reply-To: %s\r\n", m.ReplyTo)
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", m.Date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// sendMail delivers m through conf().SMTPAddr once, using STARTTLS when the
+// server offers it and authenticating when SMTPUser is set. ctx bounds the
+// whole exchange.
+func sendMail(ctx context.Context, m mailMessage) error {
+	c := conf()
+	host, _, err := net.SplitHostPort(c.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if c.SMTPUser != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.SMTPUser, c.SMTPPass, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	wc, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(m.bytes()); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// sendMailWithRetry tries sendMail up to conf().MailAttempts times, doubling
+// the wait after each failure starting from conf().MailBackoff(). When every
+// attempt fails, or ctx ends first, the message is saved to
+// conf().FailedMailDir (when set) for manual handling and the last error is
+// returned.
+func sendMailWithRetry(ctx context.Context, m mailMessage) error {
+	c := conf()
+	wait := c.MailBackoff()
+	var err error
+retry:
+	for attempt := 1; attempt <= c.MailAttempts; attempt++ {
+		if err = sendMail(ctx, m); err == nil {
+			return nil
+		}
+		slog.Warn("mail send failed", "attempt", attempt, "of", c.MailAttempts, "to", strings.Join(m.To, ", "), "err", err)
+		if attempt == c.MailAttempts {
+			break
+		}
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-ctx.Done():
+			err = errors.Join(err, ctx.Err())
+			break retry
+		}
+	}
+	if path, serr := saveFailedMail(m); serr != nil {
+		slog.Error("saving undelivered mail failed", "err", serr)
+	} else if path != "" {
+		slog.Error("mail undelivered", "saved", path)
+	}
+	return err
+}
+
+// saveFailedMail writes m as JSON into conf().FailedMailDir and returns the
+// file's path, or "" when no directory is configured.
+func saveFailedMail(m mailMessage) (string, error) {
+	dir := conf().FailedMailDir
+	if dir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, m.Date.UTC().Format("20060102T150405Z")+"-*.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// contactMail builds the notification for a contact form submission.
+func contactMail(values map[string]string, ip string) mailMessage {
+	c := conf()
+	subject := values["subject"]
+	if subject == "" {
+		subject = "Contact form message"
+	}
+	body := fmt.Sprintf("From: %s <%s>\nIP: %s\n\n%s\n", values["name"], values["email"], ip, values["message"])
+	return mailMessage{
+		From:    c.MailFrom,
+		To:      c.MailTo,
+		ReplyTo: values["email"],
+		Subject: "[" + c.Brand.Name + "] " + subject,
+		Body:    body,
+		Date:    time.Now(),
+	}
+}
@@ -1,197 +1,568 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"html/template"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 // render sends the specified HTML file through Go's html/template engine.
-// Files are expected to live under the view/ directory.
-func render(w http.ResponseWriter, filename string, data any) {
+// Files are expected to live under one of the site's view directories
+// (view/ by default); see Site.
+func render(w http.ResponseWriter, req *http.Request, filename string, data map[string]any) {
+	renderStatus(w, req, http.StatusOK, filename, data)
+}
+
+// renderStatus is like render but responds with the given status code.
+func renderStatus(w http.ResponseWriter, req *http.Request, status int, filename string, data map[string]any) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	// Safety: only allow .html files and resolve relative to view/
-	clean := filepath.Clean(filename)
-	if filepath.Ext(clean) != ".html" {
-		http.Error(w, "not found", http.StatusNotFound)
+	// Safety: only allow .html/.htm files and resolve relative to view/
+	clean, err := resolveTemplatePath(filename)
+	if err != nil {
+		writeError(w, req, http.StatusNotFound, "")
 		return
 	}
-	if strings.Contains(clean, "..") || filepath.IsAbs(clean) {
-		http.Error(w, "not found", http.StatusNotFound)
+
+	// Don't render for a client that has already gone away
+	if err := req.Context().Err(); err != nil {
+		slog.Debug("render skipped", "template", clean, "err", err)
+		return
+	}
+
+	// Missing templates degrade to the built-in fallback set
+	site := siteFrom(req)
+	fullPath, found := site.viewPath(filepath.ToSlash(clean))
+	if !found {
+		if conf().FallbackTemplates {
+			log.Printf("template %s not found, using fallback template", fullPath)
+			renderFallback(w, status, clean, pageData(req, data))
+			return
+		}
+		log.Printf("template not found: %s", fullPath)
+		writeError(w, req, http.StatusInternalServerError, "")
 		return
 	}
 
 	// If the template path is under pages/, render with base layout
-	fullPath := filepath.Join("view", clean)
 	if strings.HasPrefix(clean, "pages/") {
-		base := filepath.Join("view", "layout", "base.html")
-		if _, err := os.Stat(fullPath); err == nil {
-			tmpl, err := template.ParseFiles(base, fullPath)
-			if err != nil {
-				log.Printf("template parse error for %s: %v", fullPath, err)
-				http.Error(w, "template error", http.StatusInternalServerError)
-				return
-			}
-			if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-				log.Printf("template execute error for %s: %v", fullPath, err)
-				http.Error(w, "render error", http.StatusInternalServerError)
-				return
-			}
+		base, _ := site.viewPath("layout/base.html")
+		tmpl, err := loadTemplate(fullPath, base, fullPath)
+		if err == nil {
+			tmpl, err = withRequestFuncs(tmpl, req)
+		}
+		if err != nil {
+			log.Printf("template parse error for %s: %v", fullPath, err)
+			writeError(w, req, http.StatusInternalServerError, "")
 			return
 		}
+		execute(w, req, status, fullPath, func(out io.Writer) error {
+			return tmpl.ExecuteTemplate(out, "base", pageData(req, data))
+		})
+		return
 	}
 
-	// Fallback: render standalone file under view/
-	tmpl, err := template.ParseFiles(fullPath)
+	// Otherwise render a standalone file under view/
+	tmpl, err := loadTemplate(fullPath, fullPath)
+	if err == nil {
+		tmpl, err = withRequestFuncs(tmpl, req)
+	}
 	if err != nil {
 		log.Printf("template parse error for %s: %v", fullPath, err)
-		http.Error(w, "template error", http.StatusInternalServerError)
+		writeError(w, req, http.StatusInternalServerError, "")
 		return
 	}
-	if err := tmpl.Execute(w, data); err != nil {
-		log.Printf("template execute error for %s: %v", fullPath, err)
-		http.Error(w, "render error", http.StatusInternalServerError)
+	execute(w, req, status, fullPath, func(out io.Writer) error {
+		return tmpl.Execute(out, pageData(req, data))
+	})
+}
+
+// execute runs render and writes its output with status. Output normally
+// streams straight to the client, so a failure halfway through can only be
+// logged. With conf().StrictTemplates, conf().Minify or conf().ServerTiming
+// it is buffered instead: an execution error becomes a 500 (carrying the
+// error text in strict mode), the page is minified before it is sent, and
+// the render time is known before the headers go out.
+func execute(w http.ResponseWriter, req *http.Request, status int, name string, render func(io.Writer) error) {
+	c := conf()
+	start := time.Now()
+	if !c.StrictTemplates && !c.Minify && !c.ServerTiming {
+		w.WriteHeader(status)
+		err := render(w)
+		observeRender(w, req, name, time.Since(start))
+		if clientGone(req, err) {
+			slog.Debug("client disconnected during render", "template", name, "err", err)
+		} else if err != nil {
+			log.Printf("template execute error for %s: %v", name, err)
+		}
 		return
 	}
+
+	var buf bytes.Buffer
+	err := render(&buf)
+	observeRender(w, req, name, time.Since(start))
+	if clientGone(req, err) {
+		slog.Debug("client disconnected during render", "template", name, "err", err)
+		return
+	}
+	if err != nil {
+		log.Printf("template execute error for %s: %v", name, err)
+		msg := ""
+		if c.StrictTemplates {
+			msg = err.Error()
+		}
+		writeError(w, req, http.StatusInternalServerError, msg)
+		return
+	}
+	page := buf.Bytes()
+	if c.Minify {
+		if minified, err := minifyHTML(page); err != nil {
+			log.Printf("minify %s: %v", name, err)
+		} else {
+			page = minified
+		}
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(page); err != nil && !clientGone(req, err) {
+		log.Printf("write error for %s: %v", name, err)
+	}
 }
 
-func main() {
-	r := mux.NewRouter()
+// clientGone reports whether err is the client going away mid-response (a
+// broken pipe, a reset connection or a cancelled request) rather than a
+// template or server fault. Nothing can be sent to such a client, so these
+// are not worth more than a debug log.
+func clientGone(req *http.Request, err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, context.Canceled) || req.Context().Err() != nil
+}
 
-	// Basic Auth middleware (applies to all routes)
-	//r.Use(authMiddleware)
+// errTemplatePath is returned by resolveTemplatePath for disallowed names.
+var errTemplatePath = errors.New("invalid template path")
 
-	// Static files under /public/
-	fileServer := http.FileServer(http.Dir("public"))
-	r.PathPrefix("/public/").Handler(http.StripPrefix("/public/", fileServer))
+// resolveTemplatePath validates a template name and returns it cleaned and
+// relative to the view directory. Only .html and .htm files are allowed, in
+// any letter case, and absolute paths or names containing ".." are
+// rejected, so joining the result onto the view directory can never point
+// outside it.
+//
+// Cases worth knowing about:
+//   - "pages/../../x.html" cleans to "../x.html" and is rejected, while
+//     "pages/../x.html" cleans to "x.html" and is allowed (still inside view/).
+//   - "x..html" is rejected by the ".." check even though it is harmless.
+//   - On Windows "C:x.html" and "\\host\x.html" are not caught by IsAbs alone;
+//     filepath.IsLocal rejects them.
+func resolveTemplatePath(filename string) (string, error) {
+	clean := filepath.Clean(filename)
+	switch strings.ToLower(filepath.Ext(clean)) {
+	case ".html", ".htm":
+	default:
+		return "", errTemplatePath
+	}
+	if strings.Contains(clean, "..") || filepath.IsAbs(clean) || !filepath.IsLocal(clean) {
+		return "", errTemplatePath
+	}
+	return clean, nil
+}
 
-	// Routes mapping to existing HTML files
-	r.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/index.html", nil)
-	})
+// observeRender records how long a template took to execute, warning when it
+// exceeds the SlowRender threshold and exposing the duration to the access log
+// and the Server-Timing header.
+func observeRender(w http.ResponseWriter, req *http.Request, name string, d time.Duration) {
+	if rec := recorderFrom(w); rec != nil {
+		rec.render += d
+	}
+	recordTiming(req.Context(), "render", d)
+	if threshold := conf().SlowRender(); d > threshold {
+		slog.Warn("slow template render", "template", name, "duration", d, "threshold", threshold)
+	}
+}
 
-	r.HandleFunc("/about-us", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/about-us.html", nil)
-	})
+// templateCache holds parsed templates keyed by page path so only the first
+// request for a page pays the parse cost. Disable conf().TemplateCache to re-parse
+// on every request while editing templates locally. parsing holds the parse
+// in progress for each key, so concurrent misses wait for one parse instead
+// of each reading and parsing the files.
+var templateCache = struct {
+	sync.RWMutex
+	m       map[string]*template.Template
+	parsing map[string]*templateParse
+}{m: map[string]*template.Template{}, parsing: map[string]*templateParse{}}
 
-	r.HandleFunc("/services", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/our-services.html", nil)
-	})
+// templateParse is a template parse that other requests can wait on.
+type templateParse struct {
+	done chan struct{}
+	tmpl *template.Template
+	err  error
+}
 
-	r.HandleFunc("/training", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/training.html", nil)
-	})
+// resetTemplateCache discards all cached templates. Parses already under
+// way finish for their waiting requests but are not cached.
+func resetTemplateCache() {
+	templateCache.Lock()
+	templateCache.m = map[string]*template.Template{}
+	templateCache.parsing = map[string]*templateParse{}
+	templateCache.Unlock()
+}
 
-	r.HandleFunc("/blog", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/bloglisting.html", nil)
-	})
+// testHookParse is called at the start of every template parse; tests
+// replace it to count parses.
+var testHookParse = func() {}
 
-	// Example dynamic detail route using same template (you can personalize later)
-	r.HandleFunc("/blog/{slug}", func(w http.ResponseWriter, req *http.Request) {
-		vars := mux.Vars(req)
-		data := map[string]any{
-			"Slug": vars["slug"],
-		}
-		render(w, "pages/blogDetails.html", data)
-	})
+// parseTemplate parses files with the shared FuncMap, the config format
+// functions (see formatFuncs) and conf().TemplateDelims.
+// The template is named after the first file so Execute renders it for
+// standalone pages. With conf().StrictTemplates, referencing a missing map
+// key is an error.
+func parseTemplate(files ...string) (*template.Template, error) {
+	testHookParse()
+	c := conf()
+	tmpl := template.New(filepath.Base(files[0])).Funcs(templateFuncs).Funcs(formatFuncs(c)).Delims(c.TemplateDelims[0], c.TemplateDelims[1])
+	if c.StrictTemplates {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	return tmpl.ParseFiles(files...)
+}
 
-	r.HandleFunc("/contact", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/contact_us.html", nil)
-	})
+// loadTemplate returns the cached template for key, parsing files on a miss.
+// Cached templates are never executed directly; see withRequestFuncs.
+func loadTemplate(key string, files ...string) (*template.Template, error) {
+	if !conf().TemplateCache {
+		return parseTemplate(files...)
+	}
 
-	// Linux commands reference page (uses layout)
-	r.HandleFunc("/linux-commands", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/linux-commands.html", nil)
-	})
+	templateCache.RLock()
+	tmpl, ok := templateCache.m[key]
+	templateCache.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
 
-	// Linux directory structure page
-	r.HandleFunc("/linux-directory-structure", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/linux-directory-structure.html", nil)
-	})
+	templateCache.Lock()
+	if tmpl, ok := templateCache.m[key]; ok {
+		templateCache.Unlock()
+		return tmpl, nil
+	}
+	if p, ok := templateCache.parsing[key]; ok {
+		templateCache.Unlock()
+		<-p.done
+		return p.tmpl, p.err
+	}
+	p := &templateParse{done: make(chan struct{})}
+	templateCache.parsing[key] = p
+	templateCache.Unlock()
 
-	// Linux permissions and user management page
-	r.HandleFunc("/linux-permissions", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/linux-permissions.html", nil)
-	})
+	p.tmpl, p.err = parseTemplate(files...)
+	templateCache.Lock()
+	if templateCache.parsing[key] == p { // else the cache was reset meanwhile
+		delete(templateCache.parsing, key)
+		if p.err == nil {
+			templateCache.m[key] = p.tmpl
+		}
+	}
+	templateCache.Unlock()
+	close(p.done)
+	return p.tmpl, p.err
+}
 
-	// Golang project structure page
-	r.HandleFunc("/golang-project-structure", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/godocs/golang-project-structure.html", nil)
-	})
+// commands are the subcommands of the binary; the first argument selects
+// one, and serve is assumed when it is missing or is a flag.
+var commands = map[string]func(args []string) error{
+	"serve":  serve,
+	"check":  check,
+	"export": exportCmd,
+}
 
-	// Golang create project tutorial page
-	r.HandleFunc("/golang-create-project", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/godocs/golang-create-project.html", nil)
-	})
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q; usage: bitvistara [serve|check|export] [flags]\n", name)
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		log.Fatal(err)
+	}
+}
 
-	// Golang EC2 deployment page
-	r.HandleFunc("/golang-ec2-deploy", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/godocs/golang-ec2-deploy.html", nil)
-	})
+// serve runs the web server.
+func serve(args []string) error {
+	c, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	current.Store(c)
+	applyLogLevel(c.LogLevel)
+	if err := checkSiteDirs(c); err != nil {
+		if c.RequireDirs {
+			return err
+		}
+		log.Printf("warning: %v", err)
+	}
+	if c.DebugBodies && !debugBuild {
+		log.Printf("warning: debug_bodies is ignored; build with -tags debug to log bodies")
+	}
+	for name, values := range c.headers {
+		log.Printf("custom header: %s: %s", name, strings.Join(values, ", "))
+	}
 
-	// Golang packages explanation page
-	r.HandleFunc("/golang-packages", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/godocs/golang-packages.html", nil)
-	})
+	// SIGHUP re-reads the config file and environment
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(args)
+		}
+	}()
 
-	// Optional: if you want to expose server.html on /server
-	r.HandleFunc("/server", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/server.html", nil)
-	})
+	// SIGUSR1 starts draining ahead of a deploy
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			startDrain("SIGUSR1")
+		}
+	}()
 
-	// Under development page (standalone, no layout)
-	r.HandleFunc("/under-development", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "under-development.html", nil)
-	})
+	// Contact email is sent in the background; see outbox
+	mailOutbox = startOutbox(c.MailQueueSize)
 
-	// Roadmaps
-	r.HandleFunc("/golang", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/roadmaps/golang-roadmap.html", nil)
-	})
-	r.HandleFunc("/devops", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/roadmaps/devops-roadmap.html", nil)
-	})
-	r.HandleFunc("/project-manager", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/project-manager-roadmap.html", nil)
-	})
-	r.HandleFunc("/ai-ml", func(w http.ResponseWriter, _ *http.Request) {
-		render(w, "pages/ai-ml-roadmap.html", nil)
-	})
+	h := newHandler()
 
+	// Other instances' /admin/reload, see cluster.go
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go watchClusterSignal(watchCtx)
+
+	conns := newConnTracker()
 	srv := &http.Server{
-		Addr:    ":9090",
-		Handler: r,
+		Addr:      conf().Addr,
+		Handler:   drainConnections(serverOptions(stripBasePath(ping(startupGate(h))))),
+		ConnState: conns.track,
+		// Let serverOptions answer "OPTIONS *" instead of net/http's
+		// built-in empty 200.
+		DisableGeneralOptionsHandler: true,
 	}
 
+	// SIGTERM and SIGINT stop accepting connections and wait for in-flight
+	// requests to finish
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		<-stop.Done()
+		active, idle := conns.counts()
+		log.Printf("shutting down: waiting up to %s for %d active connection(s) (%d idle)", conf().ShutdownTimeout(), active, idle)
+		ctx, cancel := context.WithTimeout(context.Background(), conf().ShutdownTimeout())
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			active, _ := conns.counts()
+			log.Printf("shutting down: deadline reached with %d connection(s) still active; closing them", active)
+			srv.Close()
+		} else {
+			log.Printf("shutting down: all connections finished")
+		}
+		stopped <- err
+	}()
+
+	// Hash the static files and pre-render key pages so the first real
+	// visitor hits warm caches; /readyz fails (and startup_gate holds
+	// requests) until this is done
+	go func() {
+		precomputeAssetHashes(staticDirs(conf()))
+		warmup(context.Background(), h, warmupTargets())
+		initialized.Store(true)
+	}()
+
 	log.Printf("listening on http://localhost%s", srv.Addr)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+		return err
+	}
+	err = <-stopped
+	flush, cancelFlush := context.WithTimeout(context.Background(), conf().ShutdownTimeout())
+	defer cancelFlush()
+	mailOutbox.close(flush)
+	if err != nil {
+		return fmt.Errorf("shutdown: %w", err)
 	}
+	log.Printf("shutdown complete")
+	return nil
 }
 
-// authMiddleware enforces HTTP Basic authentication on all requests.
-// Configure credentials via env: BASIC_USER, BASIC_PASS. Defaults to admin/admin.
-func authMiddleware(next http.Handler) http.Handler {
-	expectedUser := os.Getenv("BASIC_USER")
-	if expectedUser == "" {
-		expectedUser = "admin"
+// newRouter registers every route for site and wraps the router in the
+// site-wide middleware chain. See chain in middleware.go for the ordering
+// rules.
+func newRouter(site Site) http.Handler {
+	var h http.Handler
+	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+
+	// Basic auth is applied per path prefix by authorize; see auth_rules
+
+	// Static files: /public/ plus any static_mounts
+	for _, m := range staticMounts(conf(), site) {
+		r.PathPrefix(m.Prefix).Handler(m.handler())
 	}
-	expectedPass := os.Getenv("BASIC_PASS")
-	if expectedPass == "" {
-		expectedPass = "0987654321"
+
+	r.HandleFunc("/favicon.ico", faviconHandler).Methods(http.MethodGet, http.MethodHead).Name("favicon")
+
+	r.HandleFunc("/manifest.webmanifest", manifestHandler).Methods(http.MethodGet, http.MethodHead).Name("manifest")
+
+	// Service worker and its offline page, see pwa.go
+	r.HandleFunc("/sw.js", swHandler).Methods(http.MethodGet, http.MethodHead).Name("service-worker")
+	r.HandleFunc("/offline.html", offlineHandler).Methods(http.MethodGet, http.MethodHead).Name("offline")
+
+	// security.txt, ACME challenges and verification files; never behind auth
+	r.PathPrefix("/.well-known/").Handler(wellKnownHandler(filepath.Join(site.PublicDir, ".well-known"))).Methods(http.MethodGet, http.MethodHead).Name("well-known")
+
+	// Static pages, see pages.go
+	for _, p := range pages {
+		r.HandleFunc(p.Path, func(w http.ResponseWriter, req *http.Request) {
+			render(w, req, p.Template, nil)
+		}).Methods(http.MethodGet, http.MethodHead).Name(p.Name)
 	}
 
+	// Example dynamic detail route using same template (you can personalize later)
+	r.HandleFunc("/blog/{slug}", func(w http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+		data := map[string]any{
+			"Slug":  vars["slug"],
+			"Title": humanize(vars["slug"]),
+		}
+		render(w, req, "pages/blogDetails.html", data)
+	}).Name("blog-detail")
+
+	r.Handle("/contact", contactHandler(newContactThrottle())).Methods(http.MethodPost).Name("contact-submit")
+
+	// Under development page (standalone, no layout)
+	r.HandleFunc("/under-development", func(w http.ResponseWriter, req *http.Request) {
+		render(w, req, "under-development.html", nil)
+	}).Name("under-development")
+
+	// Same-origin proxy to the backend API
+	if c := conf(); c.proxyTarget != nil {
+		r.PathPrefix(c.ProxyPrefix + "/").Handler(backendProxy(c.ProxyPrefix)).Name("backend-proxy")
+	}
+
+	// Liveness and readiness probes
+	r.HandleFunc("/healthz", healthzHandler).Methods(http.MethodGet, http.MethodHead).Name("healthz")
+	r.HandleFunc("/readyz", readyzHandler).Methods(http.MethodGet, http.MethodHead).Name("readyz")
+
+	// Sitemap for search engines
+	r.HandleFunc("/sitemap.xml", sitemapHandler).Methods(http.MethodGet, http.MethodHead).Name("sitemap")
+	r.HandleFunc("/sitemap.txt", sitemapTextHandler).Methods(http.MethodGet, http.MethodHead).Name("sitemap-txt")
+
+	// Admin and debug routes: allowlisted networks only (authorize applies
+	// the admin credentials)
+	admin := r.NewRoute().Subrouter()
+	admin.Use(adminAllowlist)
+
+	// Admin: re-run the page warm-up on demand
+	admin.HandleFunc("/admin/warmup", func(w http.ResponseWriter, req *http.Request) {
+		targets := warmupTargets()
+		failed := warmup(req.Context(), rootHandler, targets)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"routes": len(targets),
+			"failed": failed,
+		})
+	}).Methods(http.MethodPost).Name("admin-warmup")
+
+	// Admin: drop cached templates so edited files are picked up
+	admin.HandleFunc("/admin/reload", func(w http.ResponseWriter, _ *http.Request) {
+		clearCaches()
+		signalCluster()
+		log.Printf("reload: template and asset caches cleared")
+		if conf().SitemapPing {
+			go pingSitemap(conf().BaseURL)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodPost).Name("admin-reload")
+
+	// Admin: render the site to static files in export_dir
+	admin.HandleFunc("/admin/export", func(w http.ResponseWriter, req *http.Request) {
+		dir := conf().ExportDir
+		if dir == "" {
+			writeError(w, req, http.StatusConflict, "export_dir is not set")
+			return
+		}
+		report, err := exportSites(rootHandler, dir)
+		if err != nil {
+			log.Print(err)
+			writeError(w, req, http.StatusInternalServerError, "export failed")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}).Methods(http.MethodPost).Name("admin-export")
+
+	// Admin: fail readiness ahead of a deploy; see startDrain
+	admin.HandleFunc("/admin/drain", func(w http.ResponseWriter, _ *http.Request) {
+		startDrain("POST /admin/drain")
+		w.WriteHeader(http.StatusAccepted)
+	}).Methods(http.MethodPost).Name("admin-drain")
+
+	// Debug: route list and pprof, only in -tags debug builds
+	registerDebugRoutes(admin, r)
+
+	h = chain(r,
+		recoverPanics, // outermost: turns a panic anywhere below into a 500
+		maxURLLength,  // before accessLog so an overlong URL is logged once, truncated
+		accessLog,     // records the status and size the client actually sees
+		allowMethods,  // before routing, and before redirects that would answer any method
+		collapseSlashes,
+		redirects, // before routing so renamed pages never reach the router
+		gone,
+		decompressBody,
+		serverHeader,    // strips Server/X-Powered-By whatever sets them below
+		securityHeaders, // before customHeaders so a configured CSP header wins
+		customHeaders,   // sets defaults early so handlers can still override them
+		serverTiming,    // outside authorize so rejected requests are timed too
+		authorize,       // wraps the router so unmatched paths are covered too
+		features,        // after authorize, which decides who may override flags
+		withSite(site),
+		maintenance,  // needs the site to render the maintenance page
+		logBodies,    // inside compression so it sees plain response bodies
+		gzipResponse, // innermost: compresses the handler's raw body
+	)
+	return h
+}
+
+// adminAllowlist rejects requests whose client IP (see clientIP) is outside
+// conf().AdminAllowCIDRs with a 403. An empty allowlist admits everyone and
+// leaves authorize, with the auth_rules admin tier, as the only check.
+func adminAllowlist(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		user, pass, ok := req.BasicAuth()
-		if !ok || user != expectedUser || pass != expectedPass {
-			w.Header().Set("WWW-Authenticate", "Basic realm=Restricted")
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		if nets := conf().adminNets; len(nets) > 0 && !inPrefixes(clientIP(req), nets) {
+			slog.Warn("admin request from disallowed address", "path", req.URL.Path, "ip", clientIP(req))
+			writeError(w, req, http.StatusForbidden, "")
 			return
 		}
 		next.ServeHTTP(w, req)
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRenderCanceled(t *testing.T) {
+	resetTemplateCache()
+	t.Cleanup(resetTemplateCache)
+
+	var parses atomic.Int32
+	testHookParse = func() { parses.Add(1) }
+	t.Cleanup(func() { testHookParse = func() {} })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/about-us", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	render(rec, req, "pages/about-us.html", nil)
+
+	if n := parses.Load(); n != 0 {
+		t.Errorf("%d template parses for a canceled request", n)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("wrote %d bytes for a canceled request", rec.Body.Len())
+	}
+}
+
+func FuzzRenderPath(f *testing.F) {
+	for _, s := range []string{
+		"pages/index.html",
+		"pages/../x.html",
+		"pages/../../x.html",
+		"/etc/passwd.html",
+		"x..html",
+		`C:x.html`,
+		`\\host\x.html`,
+		"pages/index.txt",
+		"",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		clean, err := resolveTemplatePath(name)
+		if err != nil {
+			return
+		}
+		joined := filepath.Join("view", clean)
+		rel, err := filepath.Rel("view", joined)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			t.Fatalf("resolveTemplatePath(%q) = %q, escapes view/ as %q", name, clean, joined)
+		}
+		switch strings.ToLower(filepath.Ext(joined)) {
+		case ".html", ".htm":
+		default:
+			t.Fatalf("resolveTemplatePath(%q) = %q, not an .html or .htm file", name, clean)
+		}
+	})
+}
+
+func TestResolveTemplatePathExtensions(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"pages/index.html", true},
+		{"pages/index.HTML", true},
+		{"pages/index.htm", true},
+		{"pages/index.Htm", true},
+		{"pages/index.txt", false},
+		{"pages/index.html.txt", false},
+		{"pages/index", false},
+	} {
+		_, err := resolveTemplatePath(tt.name)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("resolveTemplatePath(%q) error = %v, want ok %t", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestAdminAllowlist(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.AdminAllowCIDRs = []string{"10.0.0.0/8", "2001:db8::/32"}
+		c.TrustedProxies = []string{"192.0.2.0/24"}
+	})
+	h := adminAllowlist(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tt := range []struct {
+		name, remote, xff string
+		want              int
+	}{
+		{"allowed", "10.1.2.3:4000", "", http.StatusNoContent},
+		{"allowed IPv6", "[2001:db8::1]:4000", "", http.StatusNoContent},
+		{"denied", "203.0.113.5:4000", "", http.StatusForbidden},
+		{"allowed behind trusted proxy", "192.0.2.1:4000", "10.1.2.3", http.StatusNoContent},
+		{"denied behind trusted proxy", "192.0.2.1:4000", "203.0.113.5", http.StatusForbidden},
+		{"proxy itself", "192.0.2.1:4000", "", http.StatusForbidden},
+		{"spoofed header", "203.0.113.5:4000", "10.1.2.3", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	// An empty allowlist admits everyone
+	useConfig(t, nil)
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	req.RemoteAddr = "203.0.113.5:4000"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("empty allowlist: status %d, want 204", rec.Code)
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "page.html")
+	if err := os.WriteFile(file, []byte(`<p>[{{.NoSuchKey}}]</p>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, strict := range []bool{false, true} {
+		useConfig(t, func(c *Config) { c.StrictTemplates = strict })
+		tmpl, err := parseTemplate(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run := func(accept string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/page", nil)
+			req.Header.Set("Accept", accept)
+			rec := httptest.NewRecorder()
+			execute(rec, req, http.StatusOK, "page.html", func(w io.Writer) error {
+				return tmpl.Execute(w, map[string]any{})
+			})
+			return rec
+		}
+		rec := run("text/html")
+		if !strict {
+			if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<p>[") {
+				t.Errorf("normal mode: status %d, body %q", rec.Code, rec.Body)
+			}
+			continue
+		}
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("strict mode: status %d, want 500", rec.Code)
+		}
+		// JSON clients are told which key is missing
+		if rec = run("application/json"); rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "NoSuchKey") {
+			t.Errorf("strict mode, JSON: status %d, body %q", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestStrictTemplatesPages(t *testing.T) {
+	useConfig(t, func(c *Config) { c.StrictTemplates = true })
+	resetTemplateCache()
+	t.Cleanup(resetTemplateCache)
+	h := newHandler()
+	for _, p := range pages {
+		req := httptest.NewRequest(http.MethodGet, p.Path, nil)
+		req.SetBasicAuth("admin", "0987654321")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", p.Path, rec.Code)
+		}
+	}
+}
+
+func TestTemplateCacheSingleParse(t *testing.T) {
+	useConfig(t, nil)
+	h := testHandler(t)
+	resetTemplateCache()
+	t.Cleanup(resetTemplateCache)
+
+	var parses atomic.Int32
+	testHookParse = func() {
+		parses.Add(1)
+		time.Sleep(20 * time.Millisecond) // keep the parse in flight while the others arrive
+	}
+	t.Cleanup(func() { testHookParse = func() {} })
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := do(t, h, newTestRequest(t, http.MethodGet, "/about-us", nil))
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := parses.Load(); n != 1 {
+		t.Fatalf("%d parses for 50 concurrent requests, want 1", n)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maintenanceExempt lists path prefixes served normally during maintenance so
+// operators can still reach the admin endpoints, probes keep passing and
+// certificates can renew.
+var maintenanceExempt = []string{"/admin/", "/debug/", "/public/", "/.well-known/", "/healthz", "/readyz"}
+
+// maintenanceWindow reports whether maintenance is in effect at now and, for
+// a scheduled window, when it ends. Maintenance is on when switched on
+// manually or when now falls inside [MaintenanceStart, MaintenanceEnd).
+func maintenanceWindow(c *Config, now time.Time) (active bool, end time.Time) {
+	start, _ := time.Parse(time.RFC3339, c.MaintenanceStart)
+	end, _ = time.Parse(time.RFC3339, c.MaintenanceEnd)
+	inWindow := !start.IsZero() && !end.IsZero() && !now.Before(start) && now.Before(end)
+	if !inWindow && !c.Maintenance {
+		return false, time.Time{}
+	}
+	if !end.After(now) {
+		end = time.Time{}
+	}
+	return true, end
+}
+
+// maintenance serves the maintenance page with a 503 while maintenance is in
+// effect, with Retry-After set to the end of the scheduled window.
+func maintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		active, end := maintenanceWindow(conf(), time.Now())
+		if !active {
+			next.ServeHTTP(w, req)
+			return
+		}
+		for _, prefix := range maintenanceExempt {
+			if strings.HasPrefix(req.URL.Path, prefix) {
+				next.ServeHTTP(w, req)
+				return
+			}
+		}
+
+		data := map[string]any{"MaintenanceEnd": nil}
+		if !end.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(end).Seconds())+1))
+			data["MaintenanceEnd"] = end
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		renderStatus(w, req, http.StatusServiceUnavailable, "maintenance.html", data)
+	})
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// chain wraps h in middleware, listed outermost first: chain(h, a, b) serves
+// a request through a, then b, then h. Site-wide middleware is assembled in
+// one chain call in newRouter instead of scattered r.Use calls, because the
+// order matters:
+//
+//   - recovery runs outermost so it also catches panics in other middleware;
+//   - logging runs outside anything that rewrites the response (compression,
+//     header policy) so it records what was actually sent;
+//   - auth and rate limiting run before the expensive handler work;
+//   - response transformers such as compression run innermost, closest to
+//     the handler, so they see the raw body.
+//
+// Middleware that only applies to some routes (e.g. adminAllowlist on
+// /admin) is attached to those routes instead.
+func chain(h http.Handler, middleware ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// recoverPanics converts a handler panic into a 500 response and a log line
+// instead of dropping the connection.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				slog.Error("panic serving request", "path", req.URL.Path, "panic", v, "stack", string(debug.Stack()))
+				writeError(w, req, http.StatusInternalServerError, "")
+			}
+		}()
+		next.ServeHTTP(w, req)
+	})
+}
+
+// maxLoggedPath is how much of an overlong path maxURLLength logs.
+const maxLoggedPath = 64
+
+// maxURLLength rejects requests whose path and query exceed
+// conf().MaxURLLen with a 414. It runs outside accessLog and logs the
+// rejection itself, with the path truncated, so an abusive URL never
+// reaches the logs in full.
+func maxURLLength(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit := conf().MaxURLLen
+		n := len(req.URL.EscapedPath())
+		if req.URL.RawQuery != "" {
+			n += 1 + len(req.URL.RawQuery)
+		}
+		if limit == 0 || n <= limit {
+			next.ServeHTTP(w, req)
+			return
+		}
+		p := req.URL.EscapedPath()
+		if len(p) > maxLoggedPath {
+			p = p[:maxLoggedPath] + "..."
+		}
+		slog.Warn("request URI too long", "method", req.Method, "path", p, "length", n, "limit", limit, "ip", clientIP(req))
+		writeError(w, req, http.StatusRequestURITooLong, "")
+	})
+}
+
+// collapseSlashes redirects paths containing repeated slashes, such as
+// "//about-us" or "/blog//my-post", to their single-slash form: 301 for GET
+// and HEAD, 308 otherwise so a POST is repeated as a POST with its body. It
+// works on the escaped path so encoded slashes (%2F) are preserved, and keeps
+// the query string intact. gorilla/mux would also clean these paths, but doing
+// it here makes the behavior explicit and independent of router settings.
+func collapseSlashes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := req.URL.EscapedPath()
+		if !strings.Contains(p, "//") {
+			next.ServeHTTP(w, req)
+			return
+		}
+		var b strings.Builder
+		for i := 0; i < len(p); i++ {
+			if p[i] == '/' && i > 0 && p[i-1] == '/' {
+				continue
+			}
+			b.WriteByte(p[i])
+		}
+		target := conf().BasePath + b.String()
+		if req.URL.RawQuery != "" {
+			target += "?" + req.URL.RawQuery
+		}
+		code := http.StatusMovedPermanently
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, req, target, code)
+	})
+}
+
+// decompressBody transparently decodes request bodies sent with
+// Content-Encoding gzip or deflate on methods that carry a body. The
+// decompressed body is capped at conf().MaxDecompressedBytes so a small
+// compressed payload cannot expand without bound; reading past the cap
+// fails with *http.MaxBytesError.
+func decompressBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+		switch req.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			encoding = ""
+		}
+
+		var body io.ReadCloser
+		switch encoding {
+		case "", "identity":
+			next.ServeHTTP(w, req)
+			return
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(req.Body)
+			if err != nil {
+				writeError(w, req, http.StatusBadRequest, "invalid gzip body")
+				return
+			}
+			body = zr
+		case "deflate":
+			zr, err := zlib.NewReader(req.Body)
+			if err != nil {
+				writeError(w, req, http.StatusBadRequest, "invalid deflate body")
+				return
+			}
+			body = zr
+		default:
+			writeError(w, req, http.StatusUnsupportedMediaType, "unsupported content encoding")
+			return
+		}
+		defer body.Close()
+
+		req.Body = body
+		limitBody(w, req, conf().MaxDecompressedBytes)
+		req.Header.Del("Content-Encoding")
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+		next.ServeHTTP(w, req)
+	})
+}
+
+// limitBody caps req.Body at n bytes. Handlers pass read errors to
+// bodyTooLarge so an oversized body gets the same 413 everywhere.
+func limitBody(w http.ResponseWriter, req *http.Request, n int64) {
+	req.Body = http.MaxBytesReader(w, req.Body, n)
+}
+
+// bodyTooLarge reports whether err came from a limitBody (or
+// decompressBody) cap and, if so, answers with a 413 naming the limit.
+func bodyTooLarge(w http.ResponseWriter, req *http.Request, err error) bool {
+	var mbe *http.MaxBytesError
+	if !errors.As(err, &mbe) {
+		return false
+	}
+	slog.Debug("request body too large", "path", req.URL.Path, "limit", mbe.Limit)
+	writeError(w, req, http.StatusRequestEntityTooLarge, fmt.Sprintf("The request body is larger than the %s limit.", formatBytes(mbe.Limit)))
+	return true
+}
+
+// formatBytes formats n as whole MB or KB when it divides evenly.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// allowMethods rejects requests whose method is not in
+// conf().AllowedMethods with a 405 before they reach the router, so TRACE,
+// CONNECT and made-up methods never probe a handler. Routes still match
+// their own methods within the allowed set.
+func allowMethods(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		allowed := conf().AllowedMethods
+		if !slices.Contains(allowed, req.Method) {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeError(w, req, http.StatusMethodNotAllowed, "")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// serverOptions answers the server-wide "OPTIONS *" request with a 204
+// listing conf().AllowedMethods. It wraps the whole handler because "*"
+// is not a path: the router would redirect it, and auth and the 404 page do
+// not apply to it. OPTIONS for a specific path is left to the routes.
+func serverOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodOptions && req.RequestURI == "*" {
+			w.Header().Set("Allow", strings.Join(conf().AllowedMethods, ", "))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// statusRecorder captures the status code, body size and template render
+// time of a response for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+	render time.Duration
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += n
+	return n, err
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// recorderFrom finds the accessLog recorder beneath any wrapping writers.
+func recorderFrom(w http.ResponseWriter) *statusRecorder {
+	for {
+		switch v := w.(type) {
+		case *statusRecorder:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// accessLog logs one structured line per request once it has been served.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		d := time.Since(start)
+		if !sampled(rec.status, d) {
+			return
+		}
+		slog.Info("request", accessLogAttrs(conf(), req, rec, d)...)
+	})
+}
+
+// accessLogFields are the built-in access log fields for conf().LogFields.
+var accessLogFields = []string{
+	"method", "path", "query", "status", "size", "duration", "render",
+	"ip", "user-agent", "referer", "request-id",
+}
+
+// redacted replaces logged values that conf() marks as sensitive.
+const redacted = "[redacted]"
+
+// accessLogAttrs returns the key/value pairs of conf().LogFields for one
+// request.
+func accessLogAttrs(c *Config, req *http.Request, rec *statusRecorder, d time.Duration) []any {
+	attrs := make([]any, 0, 2*len(c.LogFields))
+	for _, f := range c.LogFields {
+		var v any
+		switch f {
+		case "method":
+			v = req.Method
+		case "path":
+			v = req.URL.Path
+		case "query":
+			v = redactQuery(c, req.URL.RawQuery)
+		case "status":
+			v = rec.status
+		case "size":
+			v = rec.size
+		case "duration":
+			v = d
+		case "render":
+			v = rec.render
+		case "ip":
+			v = clientIP(req)
+		case "user-agent":
+			v = logHeader(c, req, "User-Agent")
+		case "referer":
+			v = logHeader(c, req, "Referer")
+		case "request-id":
+			v = logHeader(c, req, "X-Request-Id")
+		default:
+			name, _ := strings.CutPrefix(f, "header:")
+			v = logHeader(c, req, name)
+		}
+		attrs = append(attrs, f, v)
+	}
+	return attrs
+}
+
+// logHeader returns the request header name for the access log, redacted
+// when listed in conf().LogRedactHeaders.
+func logHeader(c *Config, req *http.Request, name string) string {
+	v := req.Header.Get(name)
+	if v != "" && slices.ContainsFunc(c.LogRedactHeaders, func(h string) bool { return strings.EqualFold(h, name) }) {
+		return redacted
+	}
+	return v
+}
+
+// redactQuery returns raw with the values of conf().LogRedactQuery
+// parameters replaced, or every value when the list contains "*".
+func redactQuery(c *Config, raw string) string {
+	if raw == "" || len(c.LogRedactQuery) == 0 {
+		return raw
+	}
+	all := slices.Contains(c.LogRedactQuery, "*")
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(key); err == nil && (all || slices.Contains(c.LogRedactQuery, name)) {
+			parts[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// sampled reports whether a request should be logged. Non-2xx responses and
+// requests slower than conf().SlowRender() always are; other requests are
+// kept with probability conf().LogSampleRate.
+func sampled(status int, d time.Duration) bool {
+	c := conf()
+	if status < 200 || status > 299 || d > c.SlowRender() || c.LogSampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < c.LogSampleRate
+}
+
+// parseCustomHeaders parses "Key: Value" lines into a header set, rejecting
+// malformed names or values so a typo fails at startup rather than per request.
+func parseCustomHeaders(spec string) (http.Header, error) {
+	h := http.Header{}
+	for _, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("custom header %q: missing ':'", line)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("custom header %q: invalid name", name)
+		}
+		if strings.ContainsFunc(value, func(r rune) bool { return r < ' ' && r != '\t' || r == 0x7f }) {
+			return nil, fmt.Errorf("custom header %q: invalid value", name)
+		}
+		h.Add(name, value)
+	}
+	return h, nil
+}
+
+// validHeaderName reports whether name is a non-empty RFC 7230 token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// customHeaders sets the configured headers on every response.
+func customHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for name, values := range conf().headers {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// okHandler answers every request with a 200 and "ok".
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func TestCollapseSlashes(t *testing.T) {
+	h := collapseSlashes(okHandler)
+
+	for _, tt := range []struct {
+		method, target string
+		status         int
+		location       string
+	}{
+		{http.MethodGet, "//", http.StatusMovedPermanently, "/"},
+		{http.MethodGet, "//about-us", http.StatusMovedPermanently, "/about-us"},
+		{http.MethodHead, "/blog//slug?page=2", http.StatusMovedPermanently, "/blog/slug?page=2"},
+		{http.MethodGet, "/blog//a%2Fb", http.StatusMovedPermanently, "/blog/a%2Fb"},
+		{http.MethodPost, "//contact", http.StatusPermanentRedirect, "/contact"},
+		// A single encoded slash is not a repeated slash
+		{http.MethodGet, "/blog/a%2Fb", http.StatusOK, ""},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+		}
+		if got := rec.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s %s: Location %q, want %q", tt.method, tt.target, got, tt.location)
+		}
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	useConfig(t, nil)
+	h := serverOptions(okHandler)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "*", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS *: status %d, want 204", rec.Code)
+	}
+	if got, want := rec.Header().Get("Allow"), strings.Join(conf().AllowedMethods, ", "); got != want {
+		t.Errorf("Allow %q, want %q", got, want)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("body %q, want none", rec.Body)
+	}
+
+	// OPTIONS for a path is left to the routes
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/about-us", nil))
+	if rec.Code == http.StatusNoContent {
+		t.Errorf("OPTIONS /about-us answered by serverOptions")
+	}
+}
+
+func gzipped(t *testing.T, s string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestDecompressBodyLimit(t *testing.T) {
+	useConfig(t, func(c *Config) { c.MaxDecompressedBytes = 1024 })
+	h := testHandler(t)
+
+	post := func(message string) *testResponse {
+		form := url.Values{"name": {"Jane"}, "email": {"jane@example.com"}, "message": {message}}
+		body := gzipped(t, form.Encode())
+		req := newTestRequest(t, http.MethodPost, "/contact", body)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Content-Encoding", "gzip")
+		return do(t, h, req)
+	}
+	// 64 KiB of text compresses to well under the limit but expands past it
+	assertStatus(t, post(strings.Repeat("a", 64<<10)), http.StatusRequestEntityTooLarge)
+	assertStatus(t, post("hello"), http.StatusOK)
+}
+
+func TestMaxURLLength(t *testing.T) {
+	useConfig(t, func(c *Config) { c.MaxURLLen = 100 })
+	h := testHandler(t)
+
+	long := "/about-us?q=" + strings.Repeat("a", 100)
+	assertStatus(t, do(t, h, newTestRequest(t, http.MethodGet, long, nil)), http.StatusRequestURITooLong)
+	long = "/" + strings.Repeat("a", 100)
+	assertStatus(t, do(t, h, newTestRequest(t, http.MethodGet, long, nil)), http.StatusRequestURITooLong)
+	// Exactly at the limit passes
+	atLimit := "/about-us?q=" + strings.Repeat("a", 100-len("/about-us?q="))
+	assertStatus(t, do(t, h, newTestRequest(t, http.MethodGet, atLimit, nil)), http.StatusOK)
+}
+
+func TestAllowMethods(t *testing.T) {
+	useConfig(t, nil)
+	h := testHandler(t)
+
+	for _, method := range []string{http.MethodTrace, http.MethodConnect, "PROPFIND"} {
+		resp := do(t, h, newTestRequest(t, method, "/about-us", nil))
+		assertStatus(t, resp, http.StatusMethodNotAllowed)
+		if got, want := resp.Header.Get("Allow"), strings.Join(conf().AllowedMethods, ", "); got != want {
+			t.Errorf("%s: Allow %q, want %q", method, got, want)
+		}
+	}
+	assertStatus(t, do(t, h, newTestRequest(t, http.MethodGet, "/about-us", nil)), http.StatusOK)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/html"
+)
+
+// htmlMinifier collapses whitespace and drops comments in rendered pages.
+// It keeps the document, end tags and attribute quotes so the output stays
+// close to the templates and easy to debug; <pre> and <textarea> content is
+// preserved by the minifier itself. Inline scripts and styles are left
+// untouched.
+var htmlMinifier = func() *minify.M {
+	m := minify.New()
+	m.Add("text/html", &html.Minifier{
+		KeepDocumentTags: true,
+		KeepEndTags:      true,
+		KeepQuotes:       true,
+	})
+	return m
+}()
+
+// minifyHTML returns the minified form of page.
+func minifyHTML(page []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(page))
+	if err := htmlMinifier.Minify("text/html", &out, bytes.NewReader(page)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinifyKeepsPreformatted(t *testing.T) {
+	for _, block := range []string{
+		"<pre>  indented\n\tline\n\n  trailing  </pre>",
+		"<pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"a  b\")\n}\n</code></pre>",
+		"<textarea name=\"message\">  keep\n  this  </textarea>",
+	} {
+		page := "<!DOCTYPE html>\n<html>\n  <body>\n    <p>  some   text  </p>\n    " + block + "\n  </body>\n</html>\n"
+		out, err := minifyHTML([]byte(page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(out), block) {
+			t.Errorf("block not preserved:\n got %q\nwant %q", out, block)
+		}
+		if strings.Contains(string(out), "some   text") {
+			t.Errorf("whitespace outside the block not collapsed: %q", out)
+		}
+	}
+}
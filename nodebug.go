@@ -0,0 +1,22 @@
+//go:build !debug
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// debugBuild is false in production builds: the /debug/ routes and body
+// logging are compiled out. Build with -tags debug to include them.
+const debugBuild = false
+
+// registerDebugRoutes adds nothing without -tags debug.
+func registerDebugRoutes(_, _ *mux.Router) {}
+
+// logBodies passes requests straight through without -tags debug;
+// conf().DebugBodies has no effect.
+func logBodies(next http.Handler) http.Handler {
+	return next
+}
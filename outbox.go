@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"sync"
+)
+
+// mailOutbox queues contact form email so the handler can answer without
+// waiting on SMTP. It is started by serve; nil means send synchronously.
+var mailOutbox *outbox
+
+// Errors returned by enqueue.
+var (
+	errOutboxFull   = errors.New("mail queue full")
+	errOutboxClosed = errors.New("mail queue closed")
+)
+
+// outbox is an in-process mail queue drained by a single background worker
+// using sendMailWithRetry. mu guards sends on queue against close, since
+// handlers may still be running when the server shuts down.
+type outbox struct {
+	mu     sync.Mutex
+	closed bool
+	queue  chan mailMessage
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startOutbox starts a worker draining a queue of up to size messages.
+func startOutbox(size int) *outbox {
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &outbox{
+		queue:  make(chan mailMessage, size),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go o.run()
+	return o
+}
+
+func (o *outbox) run() {
+	defer close(o.done)
+	for m := range o.queue {
+		ctx, cancel := context.WithTimeout(o.ctx, conf().MailTimeout())
+		if err := sendMailWithRetry(ctx, m); err != nil {
+			slog.Error("queued mail not delivered", "to", m.To, "err", err)
+		}
+		cancel()
+	}
+}
+
+// enqueue adds m to the queue without blocking. It fails with errOutboxFull
+// when the queue is full and errOutboxClosed once close has been called.
+func (o *outbox) enqueue(m mailMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return errOutboxClosed
+	}
+	select {
+	case o.queue <- m:
+		return nil
+	default:
+		return errOutboxFull
+	}
+}
+
+// depth is the number of messages waiting to be sent.
+func (o *outbox) depth() int {
+	return len(o.queue)
+}
+
+// close stops accepting messages and waits for the worker to send what is
+// queued. If ctx ends first, the in-flight send is cancelled and every
+// remaining message is saved to conf().FailedMailDir instead.
+func (o *outbox) close(ctx context.Context) {
+	o.mu.Lock()
+	if !o.closed {
+		o.closed = true
+		close(o.queue)
+	}
+	o.mu.Unlock()
+	if n := o.depth(); n > 0 {
+		log.Printf("outbox: flushing %d queued message(s)", n)
+	}
+	select {
+	case <-o.done:
+	case <-ctx.Done():
+		log.Printf("outbox: flush timed out; saving unsent messages")
+		o.cancel()
+		<-o.done
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOutboxEnqueueAfterClose(t *testing.T) {
+	o := startOutbox(1)
+	o.close(context.Background())
+	if err := o.enqueue(mailMessage{To: []string{"a@example.com"}}); !errors.Is(err, errOutboxClosed) {
+		t.Fatalf("enqueue after close = %v, want errOutboxClosed", err)
+	}
+	o.close(context.Background()) // a second close must not panic
+}
@@ -0,0 +1,41 @@
+package main
+
+// page is a static page rendered from a single template.
+type page struct {
+	Name     string // route name, used by isActive and /debug/routes
+	Path     string
+	Template string // relative to view/
+	Section  string // sitemap section, see Config.SitemapSections
+	Unlisted bool   // left out of the sitemap but still served
+}
+
+// pages lists the site's static pages. main registers a GET route for each,
+// and the sitemap is generated from the same list (except Unlisted pages).
+var pages = []page{
+	{Name: "home", Path: "/", Template: "pages/index.html", Section: "main"},
+	{Name: "about-us", Path: "/about-us", Template: "pages/about-us.html", Section: "main"},
+	{Name: "services", Path: "/services", Template: "pages/our-services.html", Section: "main"},
+	{Name: "training", Path: "/training", Template: "pages/training.html", Section: "main"},
+	{Name: "blog", Path: "/blog", Template: "pages/bloglisting.html", Section: "blog"},
+	{Name: "contact", Path: "/contact", Template: "pages/contact_us.html", Section: "main"},
+
+	// Linux reference pages
+	{Name: "linux-commands", Path: "/linux-commands", Template: "pages/linux-commands.html", Section: "training"},
+	{Name: "linux-directory-structure", Path: "/linux-directory-structure", Template: "pages/linux-directory-structure.html", Section: "training"},
+	{Name: "linux-permissions", Path: "/linux-permissions", Template: "pages/linux-permissions.html", Section: "training"},
+
+	// Golang tutorials
+	{Name: "golang-project-structure", Path: "/golang-project-structure", Template: "pages/godocs/golang-project-structure.html", Section: "training"},
+	{Name: "golang-create-project", Path: "/golang-create-project", Template: "pages/godocs/golang-create-project.html", Section: "training"},
+	{Name: "golang-ec2-deploy", Path: "/golang-ec2-deploy", Template: "pages/godocs/golang-ec2-deploy.html", Section: "training"},
+	{Name: "golang-packages", Path: "/golang-packages", Template: "pages/godocs/golang-packages.html", Section: "training"},
+
+	// Optional: exposes server.html on /server
+	{Name: "server", Path: "/server", Template: "pages/server.html", Section: "main"},
+
+	// Roadmaps
+	{Name: "golang", Path: "/golang", Template: "pages/roadmaps/golang-roadmap.html", Section: "roadmaps"},
+	{Name: "devops", Path: "/devops", Template: "pages/roadmaps/devops-roadmap.html", Section: "roadmaps"},
+	{Name: "project-manager", Path: "/project-manager", Template: "pages/roadmaps/project-manager-roadmap.html", Section: "roadmaps"},
+	{Name: "ai-ml", Path: "/ai-ml", Template: "pages/roadmaps/ai-ml-roadmap.html", Section: "roadmaps"},
+}
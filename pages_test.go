@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPageTemplatesExist(t *testing.T) {
+	for _, p := range pages {
+		if _, err := os.Stat(filepath.Join("view", filepath.FromSlash(p.Template))); err != nil {
+			t.Errorf("page %s: %v", p.Name, err)
+		}
+	}
+}
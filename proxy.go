@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyTransport carries proxied requests and the proxy readiness check,
+// so both share one connection pool. Its settings are fixed at startup.
+var proxyTransport = sync.OnceValue(func() *http.Transport {
+	c := conf()
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: time.Duration(c.ProxyDialTimeoutMS) * time.Millisecond, KeepAlive: 30 * time.Second}).DialContext
+	t.MaxIdleConns = c.ProxyMaxIdleConns
+	t.MaxIdleConnsPerHost = c.ProxyMaxIdleConns
+	t.IdleConnTimeout = time.Duration(c.ProxyIdleConnTimeoutSec) * time.Second
+	return t
+})
+
+// checkUpstream requests conf().ProxyHealthPath from the proxy target and
+// fails unless it answers below 500. A successful check also leaves a warm
+// connection in the pool for the first proxied requests.
+func checkUpstream(ctx context.Context, c *Config) error {
+	u := *c.proxyTarget
+	u.Path = strings.TrimSuffix(u.Path, "/") + c.ProxyHealthPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := proxyTransport().RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("upstream answered %s", resp.Status)
+	}
+	return nil
+}
+
+// backendProxy forwards requests under prefix to conf().ProxyTarget with
+// prefix stripped from the path. X-Forwarded-For is extended rather than
+// replaced when the peer is a trusted proxy, and upstream failures become a
+// 502.
+func backendProxy(prefix string) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Transport: proxyTransport(),
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = strings.TrimPrefix(pr.In.URL.Path, prefix)
+			pr.Out.URL.RawPath = strings.TrimPrefix(pr.In.URL.RawPath, prefix)
+			pr.SetURL(conf().proxyTarget)
+			if trustedProxy(remoteHost(pr.In)) {
+				pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			}
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, out *http.Request, err error) {
+			// ErrorHandler gets the rewritten request; answer based on
+			// the client's so writeError sees the original path.
+			in := out.Context().Value(proxyInKey{}).(*http.Request)
+			if bodyTooLarge(w, in, err) {
+				return
+			}
+			slog.Warn("proxy upstream error", "path", in.URL.Path, "upstream", out.URL.String(), "err", err)
+			writeError(w, in, http.StatusBadGateway, "upstream unavailable")
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxy.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), proxyInKey{}, req)))
+	})
+}
+
+// proxyInKey holds the client's request in the proxied request's context.
+type proxyInKey struct{}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// pwaPrecacheExts are the /public/ file types the service worker precaches:
+// the page shell, not every image.
+var pwaPrecacheExts = []string{".css", ".js", ".svg", ".ico", ".woff", ".woff2"}
+
+// serviceWorker is the generated /sw.js. It precaches the offline page and
+// the shell assets, serves precached assets from the cache, and falls back
+// to the offline page when a navigation fails.
+var serviceWorker = template.Must(template.New("sw.js").Parse(`// Generated by bitvistara; do not edit.
+const CACHE = {{.Cache}};
+const OFFLINE = {{.Offline}};
+const PRECACHE = {{.Precache}};
+
+self.addEventListener("install", (event) => {
+  event.waitUntil(caches.open(CACHE).then((cache) => cache.addAll(PRECACHE)).then(() => self.skipWaiting()));
+});
+
+self.addEventListener("activate", (event) => {
+  event.waitUntil(
+    caches.keys()
+      .then((keys) => Promise.all(keys.filter((key) => key !== CACHE).map((key) => caches.delete(key))))
+      .then(() => self.clients.claim())
+  );
+});
+
+self.addEventListener("fetch", (event) => {
+  const req = event.request;
+  if (req.method !== "GET") {
+    return;
+  }
+  if (req.mode === "navigate") {
+    event.respondWith(fetch(req).catch(() => caches.match(OFFLINE)));
+    return;
+  }
+  event.respondWith(caches.match(req).then((hit) => hit || fetch(req)));
+});
+`))
+
+// swHandler serves the generated service worker when conf().PWA is set.
+// Its scope is the whole site, so it is sent with Service-Worker-Allowed
+// and revalidated on every load so asset changes reach clients promptly.
+func swHandler(w http.ResponseWriter, req *http.Request) {
+	if !conf().PWA {
+		writeError(w, req, http.StatusNotFound, "")
+		return
+	}
+	precache := append([]string{sitePath("/offline.html")}, pwaPrecache(siteFrom(req).PublicDir)...)
+	list, _ := json.Marshal(precache)
+	sum := sha256.Sum256(list)
+	offline, _ := json.Marshal(sitePath("/offline.html"))
+	cache, _ := json.Marshal("bitvistara-" + hex.EncodeToString(sum[:])[:10])
+
+	h := w.Header()
+	h.Set("Content-Type", "application/javascript; charset=utf-8")
+	h.Set("Service-Worker-Allowed", sitePath("/"))
+	h.Set("Cache-Control", "no-cache")
+	err := serviceWorker.Execute(w, map[string]string{"Cache": string(cache), "Offline": string(offline), "Precache": string(list)})
+	if err != nil {
+		log.Printf("service worker execute error: %v", err)
+	}
+}
+
+// pwaPrecache returns the versioned URLs of the shell assets in publicDir,
+// see pwaPrecacheExts. The content hashes in the URLs also version the
+// service worker's cache.
+func pwaPrecache(publicDir string) []string {
+	var urls []string
+	filepath.WalkDir(publicDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != publicDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !slices.Contains(pwaPrecacheExts, strings.ToLower(path.Ext(d.Name()))) {
+			return nil
+		}
+		rel, err := filepath.Rel(publicDir, p)
+		if err != nil {
+			return nil
+		}
+		urls = append(urls, sitePath(assetURL(publicDir, "/public/"+filepath.ToSlash(rel))))
+		return nil
+	})
+	return urls
+}
+
+// offlineHandler renders the page the service worker shows when a
+// navigation fails. It is standalone, with inline styles, because nothing
+// else can be fetched while offline.
+func offlineHandler(w http.ResponseWriter, req *http.Request) {
+	if !conf().PWA {
+		writeError(w, req, http.StatusNotFound, "")
+		return
+	}
+	render(w, req, "offline.html", nil)
+}
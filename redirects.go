@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Redirect sends requests for From to To. A From ending in "/*" matches
+// every path under it, and a To ending in "/*" receives the rest of the
+// path, e.g. "/old/*" → "/new/*" sends /old/a/b to /new/a/b.
+type Redirect struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status int    `json:"status"` // 301 (default), 302, 307 or 308
+}
+
+// match returns the target of r for path p, or "" when r does not apply.
+func (r Redirect) match(p string) string {
+	prefix, wildcard := strings.CutSuffix(r.From, "/*")
+	if !wildcard {
+		if p != r.From {
+			return ""
+		}
+		return r.To
+	}
+	rest, ok := strings.CutPrefix(p, prefix+"/")
+	if !ok {
+		if p != prefix {
+			return ""
+		}
+		rest = ""
+	}
+	to, ok := strings.CutSuffix(r.To, "/*")
+	if !ok {
+		return r.To
+	}
+	if rest == "" {
+		return to
+	}
+	return to + "/" + rest
+}
+
+// redirects answers requests matching a conf().Redirects rule, before
+// route matching, keeping the query string. The first matching rule wins.
+func redirects(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, r := range conf().Redirects {
+			target := r.match(req.URL.Path)
+			if target == "" {
+				continue
+			}
+			if strings.HasPrefix(target, "/") {
+				target = sitePath(target)
+			}
+			if req.URL.RawQuery != "" {
+				target += "?" + req.URL.RawQuery
+			}
+			slog.Debug("redirect", "from", req.URL.Path, "to", target, "status", r.Status)
+			http.Redirect(w, req, target, r.Status)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// envRedirects reads "from=to" pairs, comma-separated, as 301 redirects
+// appended to the configured ones.
+func envRedirects(dst *[]Redirect, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("config: %s: %q is not from=to", key, item)
+		}
+		*dst = append(*dst, Redirect{From: strings.TrimSpace(from), To: strings.TrimSpace(to)})
+	}
+	return nil
+}
+
+// validateRedirects checks the rules and fills in the default status.
+func validateRedirects(rules []Redirect) []error {
+	var errs []error
+	for i := range rules {
+		r := &rules[i]
+		if r.Status == 0 {
+			r.Status = http.StatusMovedPermanently
+		}
+		switch {
+		case !strings.HasPrefix(r.From, "/"):
+			errs = append(errs, fmt.Errorf("redirects: from %q must start with /", r.From))
+		case r.To == "":
+			errs = append(errs, fmt.Errorf("redirects: %s has no target", r.From))
+		case strings.HasSuffix(r.To, "/*") && !strings.HasSuffix(r.From, "/*"):
+			errs = append(errs, fmt.Errorf("redirects: %s → %s: a wildcard target needs a wildcard source", r.From, r.To))
+		}
+		switch r.Status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			errs = append(errs, fmt.Errorf("redirects: %s: status %d must be 301, 302, 307 or 308", r.From, r.Status))
+		}
+	}
+	return errs
+}
+
+// goneMatch reports whether path p is covered by the conf().Gone pattern:
+// an exact path, a path.Match glob such as "/blog/2019-*", or a prefix
+// ending in "/*" that covers everything below it.
+func goneMatch(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && (p == prefix || strings.HasPrefix(p, prefix+"/")) {
+		return true
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// gone answers requests for permanently removed content, listed in
+// conf().Gone, with 410 Gone and the "content removed" page so crawlers drop
+// the URLs rather than retrying them as they would a 404. It runs after
+// redirects, so a removed page can still be redirected instead.
+func gone(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, pattern := range conf().Gone {
+			if goneMatch(pattern, req.URL.Path) {
+				slog.Info("gone", "path", req.URL.Path, "pattern", pattern)
+				writeError(w, req, http.StatusGone, "This content has been permanently removed.")
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// validateGone checks the conf().Gone patterns.
+func validateGone(patterns []string) []error {
+	var errs []error
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, "/") {
+			errs = append(errs, fmt.Errorf("gone: %q must start with /", p))
+		} else if _, err := path.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("gone: %q: %v", p, err))
+		}
+	}
+	return errs
+}
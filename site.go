@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Site is one website served by this process, with its own templates and
+// static files. ViewDirs, when set, replaces ViewDir with an ordered list of
+// view directories: each template, layout included, is taken from the first
+// directory that has it, so an overlay can shadow single files of a theme.
+type Site struct {
+	ViewDir   string   `json:"view_dir"`
+	ViewDirs  []string `json:"view_dirs"`
+	PublicDir string   `json:"public_dir"`
+	Lang      string   `json:"lang"` // overrides conf().DefaultLang
+}
+
+// langTag matches a plausible BCP 47 language tag, e.g. "en" or "pt-BR".
+var langTag = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// pageLang returns the language of the page served for req, as a BCP 47
+// tag, and its text direction, "rtl" when the primary subtag is one of
+// conf().RTLLangs and "ltr" otherwise.
+func pageLang(req *http.Request) (lang, dir string) {
+	c := conf()
+	lang = c.DefaultLang
+	if l := siteFrom(req).Lang; l != "" {
+		lang = l
+	}
+	primary, _, _ := strings.Cut(lang, "-")
+	for _, rtl := range c.RTLLangs {
+		if strings.EqualFold(primary, rtl) {
+			return lang, "rtl"
+		}
+	}
+	return lang, "ltr"
+}
+
+// defaultSite is served when no sites are configured.
+var defaultSite = Site{ViewDir: "view", PublicDir: "public"}
+
+// sitesOf returns c.Sites, or the default site under "" (with c.ViewDirs)
+// when none are configured.
+func sitesOf(c *Config) map[string]Site {
+	if len(c.Sites) > 0 {
+		return c.Sites
+	}
+	site := defaultSite
+	site.ViewDirs = c.ViewDirs
+	return map[string]Site{"": site}
+}
+
+// viewDirs returns the site's view directories in order of precedence.
+func (s Site) viewDirs() []string {
+	if len(s.ViewDirs) > 0 {
+		return s.ViewDirs
+	}
+	return []string{s.ViewDir}
+}
+
+// viewPath returns the path of the template rel (slash-separated, relative
+// to the view directories) in the first view directory containing it. When
+// none does, it returns the path under the first directory and false.
+func (s Site) viewPath(rel string) (string, bool) {
+	dirs := s.viewDirs()
+	for _, dir := range dirs {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+	}
+	return filepath.Join(dirs[0], filepath.FromSlash(rel)), false
+}
+
+type siteKey struct{}
+
+// withSite stores site in the request context for render and friends.
+func withSite(site Site) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), siteKey{}, site)))
+		})
+	}
+}
+
+// siteFrom returns the site serving req.
+func siteFrom(req *http.Request) Site {
+	if site, ok := req.Context().Value(siteKey{}).(Site); ok {
+		return site
+	}
+	return sitesOf(conf())[""]
+}
+
+// sitePath prefixes the root-relative path p with conf().BasePath; it is the
+// url template function, e.g. <a href="{{url "/about-us"}}">.
+func sitePath(p string) string {
+	return conf().BasePath + p
+}
+
+// stripBasePath removes conf().BasePath from request paths so routes, auth
+// rules and handlers all see root-relative paths. Requests outside the base
+// path get a 404, and the bare base path redirects to its trailing-slash form.
+func stripBasePath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		base := conf().BasePath
+		if base == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if req.URL.Path == base {
+			http.Redirect(w, req, base+"/", http.StatusMovedPermanently)
+			return
+		}
+		p, ok := strings.CutPrefix(req.URL.Path, base+"/")
+		if !ok {
+			writeError(w, req, http.StatusNotFound, "")
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *req
+		r2.URL = new(url.URL)
+		*r2.URL = *req.URL
+		r2.URL.Path = "/" + p
+		if req.URL.RawPath != "" {
+			r2.URL.RawPath = "/" + strings.TrimPrefix(req.URL.RawPath, base+"/")
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// checkSiteDirs returns an error naming every configured view, public or
+// static mount directory that does not exist.
+func checkSiteDirs(c *Config) error {
+	var errs []error
+	for _, site := range sitesOf(c) {
+		dirs := site.viewDirs()
+		for _, m := range staticMounts(c, site) {
+			dirs = append(dirs, m.Dir)
+		}
+		for _, dir := range dirs {
+			if info, err := os.Stat(dir); err != nil {
+				errs = append(errs, err)
+			} else if !info.IsDir() {
+				errs = append(errs, fmt.Errorf("%s is not a directory", dir))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rootHandler is the handler newHandler last returned. Admin routes that
+// replay requests through the site, such as /admin/warmup, use it rather
+// than their own router so each host is served by its own site.
+var rootHandler http.Handler
+
+// newHandler returns the root handler: the default site's router, or a Host
+// dispatcher with one router per site when conf().Sites is set. It is also
+// stored in rootHandler.
+func newHandler() http.Handler {
+	c := conf()
+	if len(c.Sites) == 0 {
+		rootHandler = newRouter(sitesOf(c)[""])
+		return rootHandler
+	}
+	hosts := make(map[string]http.Handler, len(c.Sites))
+	for host, site := range c.Sites {
+		hosts[normalizeHost(host)] = newRouter(site)
+	}
+	fallback := hosts[normalizeHost(c.DefaultHost)]
+	rootHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h, ok := hosts[normalizeHost(req.Host)]
+		if !ok {
+			h = fallback
+		}
+		if h == nil {
+			writeError(w, req, http.StatusNotFound, "")
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+	return rootHandler
+}
+
+// siteHosts returns the configured host names, or nil for single-site mode.
+func siteHosts() []string {
+	var hosts []string
+	for host := range conf().Sites {
+		hosts = append(hosts, normalizeHost(host))
+	}
+	return hosts
+}
+
+// normalizeHost lowercases host and strips any port and trailing dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBasePath(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.BasePath = "/site"
+		c.BaseURL = "https://example.com"
+	})
+	resetSitemapCache()
+	t.Cleanup(resetSitemapCache)
+	h := testHandler(t)
+
+	location := func(target string) string {
+		t.Helper()
+		resp := do(t, h, newTestRequest(t, http.MethodGet, target, nil))
+		assertStatus(t, resp, http.StatusMovedPermanently)
+		return resp.Header.Get("Location")
+	}
+	if got := location("/site"); got != "/site/" {
+		t.Errorf("bare base path: Location %q", got)
+	}
+	if got := location("/site//about-us"); got != "/site/about-us" {
+		t.Errorf("repeated slash: Location %q", got)
+	}
+
+	// Outside the base path: the site's 404, negotiated like any other error
+	resp := do(t, h, newTestRequest(t, http.MethodGet, "/about-us", nil))
+	assertStatus(t, resp, http.StatusNotFound)
+	assertContentType(t, resp, "text/html")
+	req := newTestRequest(t, http.MethodGet, "/about-us", nil)
+	req.Header.Set("Accept", "application/json")
+	resp = do(t, h, req)
+	assertStatus(t, resp, http.StatusNotFound)
+	assertContentType(t, resp, "application/json")
+
+	resp = do(t, h, newTestRequest(t, http.MethodGet, "/site/about-us", nil))
+	assertStatus(t, resp, http.StatusOK)
+	assertBodyContains(t, resp,
+		`href="/site/services"`,                    // url
+		`href="/site/public/`,                      // assetURL
+		`href="https://example.com/site/about-us"`, // canonical
+	)
+
+	resp = do(t, h, newTestRequest(t, http.MethodGet, "/site/sitemap.xml", nil))
+	assertStatus(t, resp, http.StatusOK)
+	assertBodyContains(t, resp, "<loc>https://example.com/site/about-us</loc>")
+}
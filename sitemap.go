@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SitemapSection holds the crawl hints for one sitemap section.
+type SitemapSection struct {
+	ChangeFreq string  `json:"changefreq"` // always, hourly, daily, weekly, monthly, yearly or never
+	Priority   float64 `json:"priority"`   // 0.0 to 1.0
+}
+
+// sitemapEntry is one URL in the sitemap.
+type sitemapEntry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+
+	modTime time.Time // full-precision LastMod, for Last-Modified
+}
+
+// sitemapEntries returns the sitemap URLs for every listed static page, resolved
+// against base. lastmod comes from each page's template modification time
+// in site's view directories.
+func sitemapEntries(base string, site Site) []sitemapEntry {
+	sections := conf().SitemapSections
+	entries := make([]sitemapEntry, 0, len(pages))
+	for _, p := range pages {
+		if p.Unlisted {
+			continue
+		}
+		e := sitemapEntry{Loc: base + (&url.URL{Path: p.Path}).EscapedPath()}
+		path, _ := site.viewPath(p.Template)
+		if info, err := os.Stat(path); err == nil {
+			e.modTime = info.ModTime()
+			e.LastMod = e.modTime.In(conf().location).Format(time.DateOnly)
+		}
+		if s, ok := sections[p.Section]; ok {
+			e.ChangeFreq = s.ChangeFreq
+			e.Priority = fmt.Sprintf("%.1f", s.Priority)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// sitemapHandler serves the XML sitemap.
+func sitemapHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	serveSitemap(w, req, "xml", func(entries []sitemapEntry) []byte {
+		set := struct {
+			XMLName xml.Name       `xml:"urlset"`
+			Xmlns   string         `xml:"xmlns,attr"`
+			URLs    []sitemapEntry `xml:"url"`
+		}{
+			Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+			URLs:  entries,
+		}
+		var buf bytes.Buffer
+		buf.WriteString(xml.Header)
+		enc := xml.NewEncoder(&buf)
+		enc.Indent("", "  ")
+		if err := enc.Encode(set); err != nil {
+			log.Printf("sitemap encode error: %v", err)
+		}
+		return buf.Bytes()
+	})
+}
+
+// sitemapTextHandler serves the sitemap as one absolute URL per line, built
+// from the same entries as the XML sitemap.
+func sitemapTextHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	serveSitemap(w, req, "txt", func(entries []sitemapEntry) []byte {
+		var buf bytes.Buffer
+		for _, e := range entries {
+			fmt.Fprintln(&buf, e.Loc)
+		}
+		return buf.Bytes()
+	})
+}
+
+// sitemapDoc is a generated sitemap held in sitemapCache.
+type sitemapDoc struct {
+	body    []byte
+	etag    string
+	modTime time.Time // newest page modification time
+	expires time.Time
+}
+
+// sitemapCache holds generated sitemaps by format, origin and view
+// directory until conf().SitemapCacheTTL passes or resetSitemapCache is
+// called. Only origins fixed by the config are cached (see
+// sitemapCacheable), so clients cannot grow it with made-up Host headers.
+var sitemapCache = struct {
+	sync.Mutex
+	m map[string]sitemapDoc
+}{m: map[string]sitemapDoc{}}
+
+// resetSitemapCache drops every cached sitemap.
+func resetSitemapCache() {
+	sitemapCache.Lock()
+	sitemapCache.m = map[string]sitemapDoc{}
+	sitemapCache.Unlock()
+}
+
+// serveSitemap serves the sitemap in format, generating it with encode on a
+// cache miss, timed as the "sitemap" Server-Timing span. Responses carry an
+// ETag and a Last-Modified of the newest page, so conditional requests from
+// crawlers get a 304.
+func serveSitemap(w http.ResponseWriter, req *http.Request, format string, encode func([]sitemapEntry) []byte) {
+	base, site := siteURL(req), siteFrom(req)
+	key := format + "\x00" + base + "\x00" + strings.Join(site.viewDirs(), "\x00")
+	ttl := conf().SitemapCacheTTL()
+	if !sitemapCacheable(req) {
+		ttl = 0
+	}
+
+	sitemapCache.Lock()
+	doc, ok := sitemapCache.m[key]
+	sitemapCache.Unlock()
+	if !ok || time.Now().After(doc.expires) {
+		done := startTiming(req.Context(), "sitemap")
+		entries := sitemapEntries(base, site)
+		doc = sitemapDoc{body: encode(entries), expires: time.Now().Add(ttl)}
+		for _, e := range entries {
+			if e.modTime.After(doc.modTime) {
+				doc.modTime = e.modTime
+			}
+		}
+		sum := sha256.Sum256(doc.body)
+		doc.etag = `"` + hex.EncodeToString(sum[:8]) + `"`
+		if ttl > 0 {
+			sitemapCache.Lock()
+			sitemapCache.m[key] = doc
+			sitemapCache.Unlock()
+		}
+		done()
+	}
+	w.Header().Set("ETag", doc.etag)
+	http.ServeContent(w, req, "", doc.modTime, bytes.NewReader(doc.body))
+}
+
+// sitemapCacheable reports whether the sitemap URLs for req come from the
+// config rather than the client: base_url in single-site mode, or a Host
+// that is exactly one of conf().Sites. Any other Host, including a default
+// site fallback, is served uncached.
+func sitemapCacheable(req *http.Request) bool {
+	c := conf()
+	if len(c.Sites) == 0 {
+		return c.BaseURL != ""
+	}
+	_, ok := c.Sites[req.Host]
+	return ok
+}
+
+// siteURL returns the public root of the site without a trailing slash:
+// conf().BaseURL when set for a single site, otherwise derived from the
+// request (https when isHTTPS, so behind a trusted proxy too), followed by
+// conf().BasePath.
+func siteURL(req *http.Request) string {
+	if base := conf().BaseURL; base != "" && len(conf().Sites) == 0 {
+		return strings.TrimRight(base, "/") + conf().BasePath
+	}
+	scheme := "http"
+	if isHTTPS(req) {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + conf().BasePath
+}
+
+// sitemapPingEndpoints are the search-engine endpoints notified of sitemap
+// changes; the sitemap URL is appended as a query escaped value.
+var sitemapPingEndpoints = []string{
+	"https://www.google.com/ping?sitemap=",
+	"https://www.bing.com/ping?sitemap=",
+}
+
+// pingSitemap notifies search engines that baseURL/sitemap.xml changed. Each
+// ping runs concurrently and the whole step is bounded by a timeout, so it is
+// safe to call in a goroutine from request handlers.
+func pingSitemap(baseURL string) {
+	if baseURL == "" {
+		log.Printf("sitemap ping: BASE_URL not set, skipping")
+		return
+	}
+	sitemap := strings.TrimRight(baseURL, "/") + sitePath("/sitemap.xml")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, endpoint := range sitemapPingEndpoints {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+			if err != nil {
+				log.Printf("sitemap ping %s: %v", target, err)
+				return
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				log.Printf("sitemap ping %s: %v", target, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= http.StatusBadRequest {
+				log.Printf("sitemap ping %s: status %d", target, resp.StatusCode)
+				return
+			}
+			log.Printf("sitemap ping %s: ok", target)
+		}(endpoint + url.QueryEscape(sitemap))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSitemapCacheHosts(t *testing.T) {
+	cached := func() int {
+		sitemapCache.Lock()
+		defer sitemapCache.Unlock()
+		return len(sitemapCache.m)
+	}
+	get := func(t *testing.T, h http.Handler, host string) *testResponse {
+		t.Helper()
+		req := newTestRequest(t, http.MethodGet, "/sitemap.xml", nil)
+		req.Host = host
+		resp := do(t, h, req)
+		assertStatus(t, resp, http.StatusOK)
+		return resp
+	}
+
+	for _, tt := range []struct {
+		name  string
+		edit  func(c *Config)
+		hosts []string
+		want  int
+	}{
+		{"single site, no base_url", nil, []string{"a.example", "b.example", "c.example"}, 0},
+		{"single site, base_url", func(c *Config) { c.BaseURL = "https://example.com" }, []string{"a.example", "b.example"}, 1},
+		{"configured sites", func(c *Config) {
+			c.Sites = map[string]Site{"example.com": defaultSite, "example.org": defaultSite}
+			c.DefaultHost = "example.com"
+		}, []string{"example.com", "example.org", "example.com", "evil.example", "EXAMPLE.com:81"}, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, tt.edit)
+			resetSitemapCache()
+			t.Cleanup(resetSitemapCache)
+			h := testHandler(t)
+			for _, host := range tt.hosts {
+				get(t, h, host)
+			}
+			if n := cached(); n != tt.want {
+				t.Errorf("%d cached sitemaps, want %d", n, tt.want)
+			}
+		})
+	}
+
+	// An unconfigured Host is still answered, with its own URLs
+	useConfig(t, nil)
+	resetSitemapCache()
+	h := testHandler(t)
+	assertBodyContains(t, get(t, h, "a.example"), "<loc>http://a.example/about-us</loc>")
+	assertBodyContains(t, get(t, h, "b.example"), "<loc>http://b.example/about-us</loc>")
+}
+
+func TestCanonicalURLScheme(t *testing.T) {
+	useConfig(t, func(c *Config) { c.TrustedProxies = []string{"192.0.2.0/24"} })
+	h := testHandler(t)
+
+	for _, tt := range []struct {
+		name, remote, proto string
+		want                string
+	}{
+		{"direct", "198.51.100.7:1234", "", "http://example.com/about-us"},
+		{"trusted proxy, https", "192.0.2.1:1234", "https", "https://example.com/about-us"},
+		{"trusted proxy, http", "192.0.2.1:1234", "http", "http://example.com/about-us"},
+		{"untrusted proxy, https", "198.51.100.7:1234", "https", "http://example.com/about-us"},
+	} {
+		req := newTestRequest(t, http.MethodGet, "/about-us", nil)
+		req.Host = "example.com"
+		req.RemoteAddr = tt.remote
+		if tt.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		resp := do(t, h, req)
+		assertStatus(t, resp, http.StatusOK)
+		if want := `<link rel="canonical" href="` + tt.want + `" />`; !strings.Contains(resp.Body, want) {
+			t.Errorf("%s: no %s in page", tt.name, want)
+		}
+	}
+}
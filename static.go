@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// StaticMount serves the files in Dir at the URL prefix Prefix, e.g.
+// {"prefix": "/media/", "dir": "uploads"}.
+type StaticMount struct {
+	Prefix       string `json:"prefix"`
+	Dir          string `json:"dir"`
+	CacheControl string `json:"cache_control"` // sent with every file; empty sends none
+	Listing      bool   `json:"listing"`       // list directories without an index.html
+}
+
+// staticMounts returns the static directories of site: its public directory
+// at /public/, followed by conf().StaticMounts.
+func staticMounts(c *Config, site Site) []StaticMount {
+	public := StaticMount{Prefix: "/public/", Dir: site.PublicDir, Listing: true}
+	return append([]StaticMount{public}, c.StaticMounts...)
+}
+
+// staticDirs returns the directory of every static mount of every site.
+func staticDirs(c *Config) []string {
+	var dirs []string
+	for _, site := range sitesOf(c) {
+		for _, m := range staticMounts(c, site) {
+			if !slices.Contains(dirs, m.Dir) {
+				dirs = append(dirs, m.Dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// handler serves m through staticHandler, so images under any mount can be
+// resized, applying the mount's cache policy and listing setting.
+func (m StaticMount) handler() http.Handler {
+	files := staticHandler(m.Dir)
+	return http.StripPrefix(strings.TrimSuffix(m.Prefix, "/"), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !m.Listing {
+			name := filepath.Join(m.Dir, filepath.FromSlash(path.Clean("/"+req.URL.Path)))
+			if info, err := os.Stat(name); err == nil && info.IsDir() {
+				if _, err := os.Stat(filepath.Join(name, "index.html")); err != nil {
+					writeError(w, req, http.StatusNotFound, "")
+					return
+				}
+			}
+		}
+		if m.CacheControl != "" {
+			w.Header().Set("Cache-Control", m.CacheControl)
+		}
+		files.ServeHTTP(w, req)
+	}))
+}
+
+// validateStaticMounts checks the configured mounts' prefixes.
+func validateStaticMounts(mounts []StaticMount) []error {
+	var errs []error
+	seen := map[string]bool{"/public/": true}
+	for _, m := range mounts {
+		switch {
+		case !strings.HasPrefix(m.Prefix, "/") || !strings.HasSuffix(m.Prefix, "/") || m.Prefix == "/":
+			errs = append(errs, fmt.Errorf("static_mounts: prefix %q must start and end with / and not be the root", m.Prefix))
+		case seen[m.Prefix]:
+			errs = append(errs, fmt.Errorf("static_mounts: prefix %s is mounted twice", m.Prefix))
+		case m.Dir == "":
+			errs = append(errs, fmt.Errorf("static_mounts: %s has no dir", m.Prefix))
+		case strings.ContainsAny(m.CacheControl, "\r\n"):
+			errs = append(errs, fmt.Errorf("static_mounts: %s: cache_control must be a single line", m.Prefix))
+		}
+		seen[m.Prefix] = true
+	}
+	return errs
+}
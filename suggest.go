@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxSuggestInput caps how much of a requested path is compared, keeping
+// the edit-distance work bounded for junk URLs.
+const maxSuggestInput = 64
+
+// notFoundHandler renders the 404 page with up to conf().NotFoundSuggestions
+// pages whose paths resemble the one requested. API clients get the plain
+// JSON error.
+func notFoundHandler(w http.ResponseWriter, req *http.Request) {
+	n := conf().NotFoundSuggestions
+	if n == 0 || wantsJSON(req) || !conf().FallbackTemplates {
+		writeError(w, req, http.StatusNotFound, "")
+		return
+	}
+	renderErrorPage(w, fallbackData{Status: http.StatusNotFound, Suggest: suggestPaths(req.URL.Path, n)})
+}
+
+// suggestPaths returns up to n page paths close to path: paths sharing a
+// prefix with it first, then by edit distance. Only the public pages table is
+// considered, so admin and debug routes are never suggested.
+func suggestPaths(path string, n int) []string {
+	path = strings.ToLower(strings.TrimSuffix(path, "/"))
+	if len(path) > maxSuggestInput {
+		path = path[:maxSuggestInput]
+	}
+	if path == "" {
+		return nil
+	}
+	type candidate struct {
+		path string
+		dist int
+	}
+	var found []candidate
+	for _, p := range pages {
+		if p.Path == "/" {
+			continue
+		}
+		var d int
+		switch {
+		case strings.HasPrefix(p.Path, path) || strings.HasPrefix(path, p.Path+"/"):
+			d = 0
+		default:
+			d = levenshtein(path, p.Path)
+			if d > max(2, len(path)/3) {
+				continue
+			}
+		}
+		found = append(found, candidate{p.Path, d})
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	var out []string
+	for i := 0; i < len(found) && i < n; i++ {
+		out = append(out, found[i].path)
+	}
+	return out
+}
+
+// levenshtein returns the edit distance between a and b, byte-wise.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
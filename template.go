@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// templateFuncs is the FuncMap every template is parsed with. Functions that
+// depend on the request are placeholders here and rebound per request by
+// withRequestFuncs.
+var templateFuncs = template.FuncMap{
+	"isActive":        func(...string) bool { return false },
+	"assetURL":        func(asset string) string { return asset },
+	"cspNonce":        func() string { return "" },
+	"isAuthenticated": func() bool { return false },
+	"feature":         func(name string) bool { return conf().Features[name] },
+	"formatDate":      formatDate,
+	"url":             sitePath,
+}
+
+// templateBuiltins are the functions text/template predefines; config
+// format functions may not shadow them.
+var templateBuiltins = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or",
+	"print", "printf", "println", "urlquery", "eq", "ge", "gt", "le", "lt", "ne",
+}
+
+// funcName matches a valid template function name.
+var funcName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// formatFuncs compiles conf().DateFormats and conf().PrintfFormats into
+// template functions. Neither can run arbitrary code: a date function only
+// formats a time.Time, a printf function only calls fmt.Sprintf.
+func formatFuncs(c *Config) template.FuncMap {
+	m := template.FuncMap{}
+	for name, layout := range c.DateFormats {
+		m[name] = func(t time.Time) string { return formatDate(t, layout) }
+	}
+	for name, format := range c.PrintfFormats {
+		m[name] = func(args ...any) string { return fmt.Sprintf(format, args...) }
+	}
+	return m
+}
+
+// validateFormatFuncs checks the names of the config format functions.
+func validateFormatFuncs(c *Config) []error {
+	var errs []error
+	seen := map[string]bool{}
+	check := func(key, name string) {
+		switch {
+		case !funcName.MatchString(name):
+			errs = append(errs, fmt.Errorf("%s: %q is not a valid function name", key, name))
+		case templateFuncs[name] != nil || slices.Contains(templateBuiltins, name):
+			errs = append(errs, fmt.Errorf("%s: %q is a built-in template function", key, name))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("%s: %q is defined in both date_formats and printf_formats", key, name))
+		}
+		seen[name] = true
+	}
+	for name := range c.DateFormats {
+		check("date_formats", name)
+	}
+	for name, format := range c.PrintfFormats {
+		check("printf_formats", name)
+		if !strings.Contains(format, "%") {
+			errs = append(errs, fmt.Errorf("printf_formats.%s: %q has no verbs", name, format))
+		}
+	}
+	return errs
+}
+
+// formatDate formats t in conf().DisplayTZ using layout, or "Jan 2, 2006"
+// when no layout is given, e.g. {{formatDate .Date "2006-01-02"}}.
+func formatDate(t time.Time, layout ...string) string {
+	l := "Jan 2, 2006"
+	if len(layout) > 0 {
+		l = layout[0]
+	}
+	return t.In(conf().location).Format(l)
+}
+
+// withRequestFuncs clones a cached template and binds the request-specific
+// template functions to req.
+func withRequestFuncs(tmpl *template.Template, req *http.Request) (*template.Template, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	active := routeName(req)
+	nonce := cspNonce(req)
+	user := authUser(req)
+	publicDir := siteFrom(req).PublicDir
+	return clone.Funcs(template.FuncMap{
+		// isActive reports whether the current route is one of names,
+		// e.g. {{if isActive "services"}}active{{end}}.
+		"isActive": func(names ...string) bool {
+			return active != "" && slices.Contains(names, active)
+		},
+		// assetURL adds a content-hash version to a /public/ path,
+		// e.g. {{assetURL "/public/css/app.css"}}.
+		"assetURL": func(asset string) string {
+			if !strings.HasPrefix(asset, "/") {
+				return asset
+			}
+			return sitePath(assetURL(publicDir, asset))
+		},
+		// cspNonce is this response's Content-Security-Policy nonce,
+		// e.g. <script nonce="{{cspNonce}}">.
+		"cspNonce": func() string { return nonce },
+		// isAuthenticated reports whether the request passed basic auth,
+		// e.g. {{if isAuthenticated}}<a href="/admin/">Admin</a>{{end}}.
+		"isAuthenticated": func() bool { return user != "" },
+		// feature reports whether a feature flag is on for this request,
+		// e.g. {{if feature "new-nav"}}...{{end}}.
+		"feature": func(name string) bool { return featureEnabled(req.Context(), name) },
+	}), nil
+}
+
+// routeName returns the name of the matched gorilla/mux route, if any.
+func routeName(req *http.Request) string {
+	if route := mux.CurrentRoute(req); route != nil {
+		return route.GetName()
+	}
+	return ""
+}
+
+// pageData returns the data common to every page merged with the handler's
+// own data. Handler values win on key collisions; a "Title" from the handler
+// also labels the last breadcrumb, and a "Canonical" URL replaces the
+// default from canonicalURL.
+func pageData(req *http.Request, data map[string]any) map[string]any {
+	title, _ := data["Title"].(string)
+	trail := breadcrumbs(req.URL.Path, title)
+	lang, dir := pageLang(req)
+	d := map[string]any{
+		"Path":              req.URL.Path,
+		"Lang":              lang,
+		"Dir":               dir,
+		"Canonical":         canonicalURL(req),
+		"ActiveRoute":       routeName(req),
+		"Captcha":           captchaTemplateData(),
+		"Analytics":         analyticsSnippet(req),
+		"PWA":               conf().PWA,
+		"Brand":             conf().Brand,
+		"User":              authUser(req),
+		"Breadcrumbs":       trail,
+		"BreadcrumbsJSONLD": breadcrumbListLD(req, trail),
+	}
+	for k, v := range data {
+		d[k] = v
+	}
+	return d
+}
+
+// canonicalURL is the absolute URL of the page at req: the site origin
+// (see siteURL) and path, without the query string or a trailing slash.
+func canonicalURL(req *http.Request) string {
+	p := req.URL.EscapedPath()
+	if p != "/" {
+		p = strings.TrimRight(p, "/")
+	}
+	return siteURL(req) + p
+}
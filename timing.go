@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timingKey is the request context key for the Server-Timing spans.
+type timingKey struct{}
+
+// serverTimings collects the named spans of one request.
+type serverTimings struct {
+	mu    sync.Mutex
+	start time.Time
+	names []string
+	durs  []time.Duration
+}
+
+// recordTiming adds a span named name lasting d to the request's
+// Server-Timing header. It does nothing unless conf().ServerTiming is set.
+// Names are metric tokens such as "render" or "data".
+func recordTiming(ctx context.Context, name string, d time.Duration) {
+	t, ok := ctx.Value(timingKey{}).(*serverTimings)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	t.names = append(t.names, name)
+	t.durs = append(t.durs, d)
+	t.mu.Unlock()
+}
+
+// startTiming starts a span and returns the function that ends it, e.g.
+// defer startTiming(req.Context(), "data")().
+func startTiming(ctx context.Context, name string) func() {
+	start := time.Now()
+	return func() { recordTiming(ctx, name, time.Since(start)) }
+}
+
+// header formats the spans recorded so far, followed by the time since the
+// request started as "total".
+func (t *serverTimings) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.names)+1)
+	for i, name := range t.names {
+		parts = append(parts, fmt.Sprintf("%s;dur=%.1f", name, float64(t.durs[i].Microseconds())/1000))
+	}
+	parts = append(parts, fmt.Sprintf("total;dur=%.1f", float64(time.Since(t.start).Microseconds())/1000))
+	return strings.Join(parts, ", ")
+}
+
+// serverTiming sends the spans recorded with recordTiming as a
+// Server-Timing header, for the browser's devtools, when
+// conf().ServerTiming is set. The header goes out with the response
+// headers, so only spans that end before the first byte is written are
+// included; execute buffers pages in this mode so "render" always is.
+func serverTiming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !conf().ServerTiming {
+			next.ServeHTTP(w, req)
+			return
+		}
+		t := &serverTimings{start: time.Now()}
+		tw := &timingWriter{ResponseWriter: w, timings: t}
+		next.ServeHTTP(tw, req.WithContext(context.WithValue(req.Context(), timingKey{}, t)))
+	})
+}
+
+type timingWriter struct {
+	http.ResponseWriter
+	timings     *serverTimings
+	wroteHeader bool
+}
+
+func (t *timingWriter) WriteHeader(code int) {
+	if !t.wroteHeader {
+		t.wroteHeader = true
+		t.Header().Set("Server-Timing", t.timings.header())
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *timingWriter) Write(b []byte) (int, error) {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *timingWriter) Flush() {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *timingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
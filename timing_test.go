@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServerTimingSitemap(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.ServerTiming = true
+		c.BaseURL = "https://example.com" // only config-fixed origins are cached
+	})
+	resetSitemapCache()
+	t.Cleanup(resetSitemapCache)
+	h := testHandler(t)
+
+	resp := do(t, h, newTestRequest(t, http.MethodGet, "/sitemap.xml", nil))
+	assertStatus(t, resp, http.StatusOK)
+	if got := resp.Header.Get("Server-Timing"); !strings.Contains(got, "sitemap;dur=") {
+		t.Errorf("Server-Timing = %q, want a sitemap span", got)
+	}
+
+	// Served from the cache: nothing built, nothing timed
+	resp = do(t, h, newTestRequest(t, http.MethodGet, "/sitemap.xml", nil))
+	if got := resp.Header.Get("Server-Timing"); strings.Contains(got, "sitemap;") {
+		t.Errorf("cached sitemap: Server-Timing = %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// warmupTargets returns the warm-up routes, expanded to absolute URLs for
+// every configured host when serving multiple sites.
+func warmupTargets() []string {
+	routes := conf().WarmupRoutes
+	hosts := siteHosts()
+	if len(hosts) == 0 {
+		return routes
+	}
+	var targets []string
+	for _, host := range hosts {
+		for _, route := range routes {
+			targets = append(targets, "http://"+host+route)
+		}
+	}
+	return targets
+}
+
+// warmup renders each route through h so the template cache is populated
+// before real traffic arrives. Routes are rendered concurrently by a bounded
+// pool of conf().WarmupWorkers goroutines; cancelling ctx stops dispatching
+// further routes. It returns the routes that failed to render.
+func warmup(ctx context.Context, h http.Handler, routes []string) []string {
+	workers := conf().WarmupWorkers
+	start := time.Now()
+	jobs := make(chan string)
+	failed := []string{}
+	rendered := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for route := range jobs {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, route, nil).WithContext(ctx)
+				// Pages behind the shared password must still warm up
+				req.SetBasicAuth(conf().BasicUser, conf().BasicPass)
+				h.ServeHTTP(rec, req)
+				mu.Lock()
+				rendered++
+				if rec.Code >= http.StatusBadRequest {
+					log.Printf("warmup: %s returned %d", route, rec.Code)
+					failed = append(failed, route)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	cancelled := false
+dispatch:
+	for _, route := range routes {
+		select {
+		case jobs <- route:
+		case <-ctx.Done():
+			cancelled = true
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if cancelled {
+		log.Printf("warmup: cancelled (%v) after rendering %d of %d routes (%d failed) in %s",
+			ctx.Err(), rendered, len(routes), len(failed), time.Since(start))
+	} else {
+		log.Printf("warmup: rendered %d routes (%d failed) in %s", rendered, len(failed), time.Since(start))
+	}
+	return failed
+}
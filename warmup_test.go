@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmupLog(t *testing.T) {
+	useConfig(t, func(c *Config) { c.WarmupWorkers = 1 })
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	routes := []string{"/a", "/b", "/c"}
+
+	warmup(context.Background(), okHandler, routes)
+	if got := buf.String(); !strings.Contains(got, "warmup: rendered 3 routes (0 failed)") {
+		t.Errorf("complete run logged:\n%s", got)
+	}
+
+	// The first route cancels the run and keeps the only worker busy, so
+	// nothing else is dispatched
+	buf.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+	})
+	warmup(ctx, h, routes)
+	if got := buf.String(); !strings.Contains(got, "warmup: cancelled (context canceled) after rendering 1 of 3 routes (0 failed)") {
+		t.Errorf("cancelled run logged:\n%s", got)
+	}
+}
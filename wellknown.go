@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// wellKnownHandler serves files from dir at /.well-known/ without
+// authentication, for security.txt, ACME HTTP-01 challenges and domain
+// verification files. Only regular files are served: directories get a 404
+// rather than a listing. Files without an extension, such as ACME tokens,
+// are sent as text/plain.
+func wellKnownHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.StripPrefix("/.well-known", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// http.Dir already confines lookups to dir; cleaning here keeps the
+		// Stat below on the same path.
+		name := path.Clean("/" + req.URL.Path)
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || !info.Mode().IsRegular() {
+			writeError(w, req, http.StatusNotFound, "")
+			return
+		}
+		if path.Ext(name) == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		files.ServeHTTP(w, req)
+	}))
+}